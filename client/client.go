@@ -2,8 +2,10 @@ package client
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
@@ -84,7 +86,28 @@ func OAuth2Source(ctx0 context.Context, url string, creds Credentials, scope str
 		PrivateClaims: nil,
 		UseIDToken:    false,
 	}
-	return config.TokenSource(ctx)
+	return oauth2.ReuseTokenSource(nil, assertionSource{ctx: ctx, config: config})
+}
+
+// assertionSource signs every assertion with a unique 'jti', servers may
+// reject a reused one
+type assertionSource struct {
+	ctx    context.Context
+	config oauth2JWT.Config
+}
+
+func (x assertionSource) Token() (*oauth2.Token, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, errors.WithMessage(err, "assertion id")
+	}
+
+	config := x.config
+	config.PrivateClaims = map[string]interface{}{
+		"jti": base64.RawURLEncoding.EncodeToString(id),
+	}
+	return config.TokenSource(x.ctx).Token()
 }
 
 func updateContext(ctx0 context.Context) (context.Context, error) {
@@ -11,6 +11,7 @@ import (
 	"formation.engineering/library/lib/telemetry/v1"
 	server "formation.engineering/oauth2-jwt/server/client"
 	"formation.engineering/oauth2-jwt/store/memory"
+	"gopkg.in/square/go-jose.v2/jwt"
 )
 
 func TestJWTFetch_JSONResponse(t *testing.T) {
@@ -26,7 +27,12 @@ func TestJWTFetch_JSONResponse(t *testing.T) {
 	defer ts.Close()
 
 	b := telemetry.NewBuilder(&telemetry.NoOp{})
-	req := server.Request{"tenant", "name", "application", "darren"}
+	req := server.Request{
+		TenantID:        "tenant",
+		TenantName:      "name",
+		ApplicationName: "application",
+		CreatedBy:       "darren",
+	}
 	creds, err := server.NewCredentials(b, memory.NewMemoryStore(), server.TestRSAGenerator{}, req)
 	if err != nil {
 		log.Fatal(err.Error())
@@ -60,3 +66,49 @@ func TestJWTFetch_JSONResponse(t *testing.T) {
 		t.Errorf("scope = %q; want %q", got, want)
 	}
 }
+
+func TestAssertionID(t *testing.T) {
+	ids := map[string]bool{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertion, err := jwt.ParseSigned(r.FormValue("assertion"))
+		if err != nil {
+			t.Error(err)
+		}
+		var claims jwt.Claims
+		assertion.UnsafeClaimsWithoutVerification(&claims)
+		ids[claims.ID] = true
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "token", "token_type": "bearer", "expires_in": 1}`))
+	}))
+	defer ts.Close()
+
+	b := telemetry.NewBuilder(&telemetry.NoOp{})
+	req := server.Request{
+		TenantID:        "tenant",
+		TenantName:      "name",
+		ApplicationName: "application",
+		CreatedBy:       "darren",
+	}
+	creds, err := server.NewCredentials(b, memory.NewMemoryStore(), server.TestRSAGenerator{}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ExtractKey((*creds).PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tokens expire within the expiry delta, so each call fetches
+	source := OAuth2Source(context.Background(), ts.URL, *key, "scope")
+	for i := 0; i < 2; i++ {
+		if _, err := source.Token(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(ids) != 2 || ids[""] {
+		t.Fatalf("expected 2 unique assertion ids, got %v", ids)
+	}
+}
@@ -0,0 +1,24 @@
+package grpc
+
+import (
+	"context"
+
+	"formation.engineering/oauth2-jwt/client"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/oauth"
+)
+
+// PerRPCCredentials sends a bearer token from client.OAuth2Source with
+// every call, use with grpc.WithPerRPCCredentials. Tokens are only sent
+// over a secure transport.
+func PerRPCCredentials(ctx context.Context, url string, creds client.Credentials, scope string) credentials.PerRPCCredentials {
+	return PerRPCCredentialsFromSource(client.OAuth2Source(ctx, url, creds, scope))
+}
+
+// PerRPCCredentialsFromSource asks source for a token on every call, it
+// must cache tokens itself (client.OAuth2Source does), i.e. wrap it with
+// oauth2.ReuseTokenSource.
+func PerRPCCredentialsFromSource(source oauth2.TokenSource) credentials.PerRPCCredentials {
+	return oauth.TokenSource{TokenSource: source}
+}
@@ -0,0 +1,125 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/client"
+	server "formation.engineering/oauth2-jwt/server/client"
+	"formation.engineering/oauth2-jwt/store/memory"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestPerRPCCredentials(t0 *testing.T) {
+	var fetches int64
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer ts.Close()
+
+	b := telemetry.NewTestingBuilder(t0)
+	req := server.Request{
+		TenantID:        "tenant",
+		TenantName:      "name",
+		ApplicationName: "application",
+		CreatedBy:       "darren",
+	}
+	creds, err := server.NewCredentials(b, memory.NewMemoryStore(), server.TestRSAGenerator{}, req)
+	if err != nil {
+		t0.Fatal(err)
+	}
+	key, err := client.ExtractKey(creds.PrivateKey)
+	if err != nil {
+		t0.Fatal(err)
+	}
+
+	// a gRPC server reusing the test certificate, the 'authorization'
+	// metadata of each call is sent on received
+	received := make(chan []string, 4)
+	srv := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: ts.TLS.Certificates})),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			received <- md.Get("authorization")
+			return nil
+		}),
+	)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t0.Fatal(err)
+	}
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	call := func(t *testing.T, rpc credentials.PerRPCCredentials) []string {
+		conn, err := grpc.Dial(lis.Addr().String(),
+			grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(pool, "")),
+			grpc.WithPerRPCCredentials(rpc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ServerStreams: true}, "/test.Service/Method")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.RecvMsg(nil); err != io.EOF {
+			t.Fatalf("expected EOF got [%v]", err)
+		}
+		return <-received
+	}
+
+	check := func(t *testing.T, got []string, want string) {
+		if len(got) != 1 || got[0] != want {
+			t.Fatalf("authorization = %q; want %q", got, want)
+		}
+	}
+
+	t0.Run("metadata", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, ts.Client())
+		rpc := PerRPCCredentials(ctx, ts.URL, *key, "read")
+		if !rpc.RequireTransportSecurity() {
+			t.Fatal("expected transport security to be required")
+		}
+
+		// the token is fetched once and reused
+		check(t, call(t, rpc), "Bearer token")
+		check(t, call(t, rpc), "Bearer token")
+		if n := atomic.LoadInt64(&fetches); n != 1 {
+			t.Fatalf("expected 1 token fetch got [%d]", n)
+		}
+	})
+
+	t0.Run("source", func(t *testing.T) {
+		rpc := PerRPCCredentialsFromSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "static"}))
+		check(t, call(t, rpc), "Bearer static")
+	})
+
+	t0.Run("insecure", func(t *testing.T) {
+		rpc := PerRPCCredentialsFromSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "static"}))
+		_, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(rpc))
+		if err == nil {
+			t.Fatal("expected the token to be refused over an insecure transport")
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package edge
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultDenyListSize caps the entries held by a MemoryDenyList
+	DefaultDenyListSize = 100000
+
+	// DefaultDenyListTenantSize caps the entries of one tenant
+	DefaultDenyListTenantSize = 10000
+
+	// DefaultDenyListInterval between polls of the server revoked list
+	DefaultDenyListInterval = 30 * time.Second
+
+	maxDenyListSize = 16 * 1024 * 1024
+)
+
+var (
+	Revoked = errors.New("token revoked")
+
+	// DenyListFull is returned by Add when a revocation is refused, see
+	// MemoryDenyList
+	DenyListFull = errors.New("deny list full")
+)
+
+// DenyList reports tokens revoked before they expire, by tenant and 'jti'
+type DenyList interface {
+	Revoked(tenantID, tokenID string) bool
+}
+
+// MemoryDenyList is a bounded in-memory DenyList. Entries are dropped
+// once the token expires, as the token is rejected anyway.
+//
+// The list holds at most size unexpired revocations, and tenantSize of
+// any one tenant. A revocation refused by either bound fails the list
+// closed for its tenant only: every token of the tenant is reported
+// revoked until the refused revocation expires. A tenant revoking its
+// own tokens can't fill the list for the others, size it above
+// tenantSize times the tenants revoking at once.
+//
+// Revocations can be pushed with Add, or polled with PollingDenyList.
+type MemoryDenyList struct {
+	size       int
+	tenantSize int
+	now        func() time.Time
+
+	mu      sync.RWMutex
+	entries map[string]*denied
+	tenants map[string]int
+	expiry  expiryHeap
+	// closed tenants until their last refused revocation expires
+	closed map[string]time.Time
+}
+
+type denied struct {
+	tenantID string
+	tokenID  string
+	expiry   time.Time
+	index    int
+}
+
+// NewMemoryDenyList holds at most size entries and tenantSize of a
+// tenant, 0 defaults to DefaultDenyListSize and DefaultDenyListTenantSize
+func NewMemoryDenyList(size, tenantSize int) *MemoryDenyList {
+	if size <= 0 {
+		size = DefaultDenyListSize
+	}
+	if tenantSize <= 0 {
+		tenantSize = DefaultDenyListTenantSize
+	}
+
+	return &MemoryDenyList{
+		size:       size,
+		tenantSize: tenantSize,
+		now:        time.Now,
+		entries:    make(map[string]*denied),
+		tenants:    make(map[string]int),
+		closed:     make(map[string]time.Time),
+	}
+}
+
+// Add denies tokenID of tenantID until expiry, a revocation refused by a
+// full list returns DenyListFull
+func (x *MemoryDenyList) Add(tenantID, tokenID string, expiry time.Time) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	now := x.now()
+	if tokenID == "" || !expiry.After(now) {
+		return nil
+	}
+
+	if entry, ok := x.entries[tokenID]; ok {
+		if expiry.After(entry.expiry) {
+			entry.expiry = expiry
+			heap.Fix(&x.expiry, entry.index)
+		}
+		return nil
+	}
+
+	x.prune(now)
+	if len(x.entries) >= x.size || x.tenants[tenantID] >= x.tenantSize {
+		if expiry.After(x.closed[tenantID]) {
+			x.closed[tenantID] = expiry
+		}
+		return fmt.Errorf("tenant [%s] token [%s]: %w", tenantID, tokenID, DenyListFull)
+	}
+
+	entry := &denied{tenantID: tenantID, tokenID: tokenID, expiry: expiry}
+	heap.Push(&x.expiry, entry)
+	x.entries[tokenID] = entry
+	x.tenants[tenantID]++
+	return nil
+}
+
+// Revoked reports every token of a tenant the list is failing closed for
+func (x *MemoryDenyList) Revoked(tenantID, tokenID string) bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	now := x.now()
+	if x.closed[tenantID].After(now) {
+		return true
+	}
+
+	entry, ok := x.entries[tokenID]
+	return ok && entry.expiry.After(now)
+}
+
+// Len is the number of entries, including any expired but not yet pruned
+func (x *MemoryDenyList) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.entries)
+}
+
+func (x *MemoryDenyList) prune(now time.Time) {
+	for len(x.expiry) > 0 && !x.expiry[0].expiry.After(now) {
+		entry := heap.Pop(&x.expiry).(*denied)
+		delete(x.entries, entry.tokenID)
+		x.tenants[entry.tenantID]--
+		if x.tenants[entry.tenantID] == 0 {
+			delete(x.tenants, entry.tenantID)
+		}
+	}
+	for tenantID, until := range x.closed {
+		if !until.After(now) {
+			delete(x.closed, tenantID)
+		}
+	}
+}
+
+// expiryHeap orders entries soonest expiry first
+type expiryHeap []*denied
+
+func (x expiryHeap) Len() int           { return len(x) }
+func (x expiryHeap) Less(i, j int) bool { return x[i].expiry.Before(x[j].expiry) }
+
+func (x expiryHeap) Swap(i, j int) {
+	x[i], x[j] = x[j], x[i]
+	x[i].index = i
+	x[j].index = j
+}
+
+func (x *expiryHeap) Push(v interface{}) {
+	entry := v.(*denied)
+	entry.index = len(*x)
+	*x = append(*x, entry)
+}
+
+func (x *expiryHeap) Pop() interface{} {
+	old := *x
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*x = old[:len(old)-1]
+	return entry
+}
+
+type DenyListOptions struct {
+	// Interval between polls, defaults to DefaultDenyListInterval
+	Interval time.Duration
+
+	// Size of the list, defaults to DefaultDenyListSize
+	Size int
+
+	// TenantSize caps the entries of one tenant, defaults to
+	// DefaultDenyListTenantSize
+	TenantSize int
+
+	// Timeout of a poll, defaults to DefaultFetchTimeout
+	Timeout time.Duration
+
+	// Client defaults to a client with a DefaultFetchTimeout timeout. The
+	// server only serves /revoked to tokens with the 'revoked' scope, so
+	// this is a client adding one, i.e. oauth2.NewClient with
+	// client.OAuth2Source.
+	Client *http.Client
+}
+
+// PollingDenyList is a MemoryDenyList kept in sync with the revoked
+// list published by the server at /revoked
+type PollingDenyList struct {
+	*MemoryDenyList
+
+	ctx  context.Context
+	url  string
+	opts DenyListOptions
+}
+
+// NewPollingDenyList polls url until ctx is done, the first poll is
+// started immediately.
+func NewPollingDenyList(ctx context.Context, url string, opts DenyListOptions) *PollingDenyList {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultDenyListInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultFetchTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: opts.Timeout}
+	}
+
+	x := &PollingDenyList{
+		MemoryDenyList: NewMemoryDenyList(opts.Size, opts.TenantSize),
+		ctx:            ctx,
+		url:            url,
+		opts:           opts,
+	}
+
+	go x.run(ctx)
+
+	return x
+}
+
+func (x *PollingDenyList) run(ctx context.Context) {
+	ticker := time.NewTicker(x.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		// errors are retried on the next tick
+		_ = x.Refresh()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh fetches the revoked list and adds every entry
+func (x *PollingDenyList) Refresh() error {
+	ctx, cancel := context.WithTimeout(x.ctx, x.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, x.url, nil)
+	if err != nil {
+		return errors.WithMessage(err, "revoked list request")
+	}
+
+	res, err := x.opts.Client.Do(req)
+	if err != nil {
+		return errors.WithMessage(err, "get revoked list")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("get revoked list: unexpected status [%d]", res.StatusCode)
+	}
+
+	// see server.RevokedResponse
+	type revokedResponse struct {
+		Revoked []struct {
+			TenantID string `json:"tenant_id"`
+			TokenID  string `json:"jti"`
+			Expiry   int64  `json:"exp"`
+		} `json:"revoked"`
+	}
+
+	var list revokedResponse
+	err = json.NewDecoder(io.LimitReader(res.Body, maxDenyListSize)).Decode(&list)
+	if err != nil {
+		return errors.WithMessage(err, "decode revoked list")
+	}
+
+	// every entry is added, a full tenant still fails closed
+	var full error
+	for _, r := range list.Revoked {
+		err := x.Add(r.TenantID, r.TokenID, time.Unix(r.Expiry, 0))
+		if err != nil && full == nil {
+			full = err
+		}
+	}
+
+	return full
+}
@@ -0,0 +1,112 @@
+package edge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryDenyList(t *testing.T) {
+	now := time.Now()
+	deny := NewMemoryDenyList(2, 0)
+	deny.now = func() time.Time { return now }
+
+	add := func(tokenID string, expiry time.Time) {
+		if err := deny.Add("tenant", tokenID, expiry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	revoked := func(tokenID string) bool {
+		return deny.Revoked("tenant", tokenID)
+	}
+
+	add("a", now.Add(time.Hour))
+	add("b", now.Add(time.Minute))
+	add("expired", now.Add(-time.Minute))
+
+	if !revoked("a") || !revoked("b") {
+		t.Fatal("expected [a] and [b] to be revoked")
+	}
+	if revoked("expired") || deny.Len() != 2 {
+		t.Fatalf("expected expired entry to be ignored, len [%d]", deny.Len())
+	}
+
+	// Expired entries are pruned to make room
+	now = now.Add(2 * time.Minute)
+	add("c", now.Add(time.Hour))
+	if revoked("b") || !revoked("a") || !revoked("c") || deny.Len() != 2 {
+		t.Fatalf("expected [a] and [c] to be revoked, len [%d]", deny.Len())
+	}
+
+	// Full, the revocation is refused and every token of the tenant is
+	// revoked until it expires
+	err := deny.Add("tenant", "d", now.Add(2*time.Hour))
+	if !errors.Is(err, DenyListFull) {
+		t.Fatalf("expected [%v] got [%v]", DenyListFull, err)
+	}
+	if !revoked("d") || !revoked("other") || deny.Len() != 2 {
+		t.Fatalf("expected the list to fail closed, len [%d]", deny.Len())
+	}
+	if deny.Revoked("other", "other") {
+		t.Fatal("expected other tenants to be unaffected")
+	}
+
+	now = now.Add(2*time.Hour + time.Second)
+	if revoked("d") || revoked("other") || revoked("a") || revoked("c") {
+		t.Fatal("expected the list to be open once [d] expired")
+	}
+}
+
+func TestMemoryDenyListTenant(t *testing.T) {
+	now := time.Now()
+	deny := NewMemoryDenyList(10, 2)
+	deny.now = func() time.Time { return now }
+
+	for _, tokenID := range []string{"a", "b"} {
+		if err := deny.Add("noisy", tokenID, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// one tenant revoking more than its share only closes itself
+	err := deny.Add("noisy", "c", now.Add(time.Hour))
+	if !errors.Is(err, DenyListFull) {
+		t.Fatalf("expected [%v] got [%v]", DenyListFull, err)
+	}
+	if !deny.Revoked("noisy", "other") || deny.Len() != 2 {
+		t.Fatalf("expected the tenant to fail closed, len [%d]", deny.Len())
+	}
+
+	err = deny.Add("quiet", "d", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deny.Revoked("quiet", "d") || deny.Revoked("quiet", "other") {
+		t.Fatal("expected other tenants to be unaffected")
+	}
+}
+
+func TestPollingDenyList(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"revoked":[{"tenant_id":"tenant","jti":"a","exp":%d},{"tenant_id":"tenant","jti":"expired","exp":1}]}`, exp)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deny := NewPollingDenyList(ctx, ts.URL, DenyListOptions{Interval: time.Hour})
+	err := deny.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !deny.Revoked("tenant", "a") || deny.Revoked("tenant", "expired") || deny.Revoked("tenant", "b") {
+		t.Fatal("unexpected deny list")
+	}
+}
@@ -0,0 +1,7 @@
+package edge
+
+import "time"
+
+func SetNow(x *KeySet, now func() time.Time) {
+	x.now = now
+}
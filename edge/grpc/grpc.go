@@ -0,0 +1,76 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/edge"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor verifies the 'authorization' metadata of every
+// call, the verified principal is available with edge.PrincipalFromContext.
+// opts.Realm and opts.ErrorWriter are not used.
+func UnaryServerInterceptor(opts edge.MiddlewareOptions) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls
+func StreamServerInterceptor(opts edge.MiddlewareOptions) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), opts)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (x *serverStream) Context() context.Context {
+	return x.ctx
+}
+
+func authenticate(ctx context.Context, opts edge.MiddlewareOptions) (context.Context, error) {
+	var b telemetry.Builder
+	if opts.NewBuilder != nil {
+		b = opts.NewBuilder()
+	} else {
+		b = telemetry.NewBuilder(&telemetry.NoOp{})
+	}
+	defer b.Push()
+
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+
+	p, berr := edge.Authenticate(b, opts, header)
+	if berr != nil {
+		b.Bool("authorization_failure", true)
+		b.String("authorization_failure_message", berr.Error())
+		// the full error is only logged
+		if errors.Is(berr, edge.InsufficientScope) {
+			return nil, status.Error(codes.PermissionDenied, berr.ClientMessage())
+		}
+		return nil, status.Error(codes.Unauthenticated, berr.ClientMessage())
+	}
+
+	return edge.WithPrincipal(ctx, p), nil
+}
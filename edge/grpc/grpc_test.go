@@ -0,0 +1,103 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/edge"
+	"formation.engineering/oauth2-jwt/server"
+	"formation.engineering/oauth2-jwt/server/admin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (x *testStream) Context() context.Context {
+	return x.ctx
+}
+
+func TestInterceptors(t0 *testing.T) {
+	b := telemetry.NewTestingBuilder(t0)
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t0.Fatal(err)
+	}
+	grant, err := server.Grant(b, server.Config{PrivateKey: serverCreds.PrivateKey}, server.Authorized{TenantID: "tenant", Scopes: []string{"read"}})
+	if err != nil {
+		t0.Fatal(err)
+	}
+
+	opts := func(scopes ...string) edge.MiddlewareOptions {
+		return edge.MiddlewareOptions{
+			Keys:           edge.StaticKey{PublicKey: serverCreds.PublicKey},
+			RequiredScopes: scopes,
+		}
+	}
+
+	withToken := func(header string) context.Context {
+		if header == "" {
+			return context.Background()
+		}
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", header))
+	}
+
+	unary := func(o edge.MiddlewareOptions, header string) (*edge.Principal, error) {
+		var p *edge.Principal
+		_, err := UnaryServerInterceptor(o)(withToken(header), nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			p, _ = edge.PrincipalFromContext(ctx)
+			return nil, nil
+		})
+		return p, err
+	}
+
+	check := func(t *testing.T, err error, code codes.Code) {
+		if status.Code(err) != code {
+			t.Fatalf("code = %s; want %s (%v)", status.Code(err), code, err)
+		}
+	}
+
+	t0.Run("unary", func(t *testing.T) {
+		p, err := unary(opts("read"), "Bearer "+grant.Token)
+		check(t, err, codes.OK)
+		if p == nil || p.TenantID != "tenant" {
+			t.Fatalf("unexpected principal %v", p)
+		}
+
+		_, err = unary(opts(), "")
+		check(t, err, codes.Unauthenticated)
+
+		_, err = unary(opts(), "Bearer invalid")
+		check(t, err, codes.Unauthenticated)
+		// only the description is sent, not why the token failed
+		if msg := status.Convert(err).Message(); msg != "invalid_token: the access token is invalid" {
+			t.Fatalf("unexpected message [%s]", msg)
+		}
+
+		_, err = unary(opts("admin"), "Bearer "+grant.Token)
+		check(t, err, codes.PermissionDenied)
+	})
+
+	t0.Run("stream", func(t *testing.T) {
+		var p *edge.Principal
+		handler := func(srv interface{}, ss grpc.ServerStream) error {
+			p, _ = edge.PrincipalFromContext(ss.Context())
+			return nil
+		}
+
+		err := StreamServerInterceptor(opts())(nil, &testStream{ctx: withToken("Bearer " + grant.Token)}, &grpc.StreamServerInfo{}, handler)
+		check(t, err, codes.OK)
+		if p == nil || p.TenantID != "tenant" {
+			t.Fatalf("unexpected principal %v", p)
+		}
+
+		err = StreamServerInterceptor(opts())(nil, &testStream{ctx: withToken("")}, &grpc.StreamServerInfo{}, handler)
+		check(t, err, codes.Unauthenticated)
+	})
+}
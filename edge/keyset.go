@@ -0,0 +1,258 @@
+package edge
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	// DefaultKeySetTTL is how long fetched keys are used before re-fetching
+	DefaultKeySetTTL = 15 * time.Minute
+
+	// DefaultMinRefreshInterval limits re-fetches triggered by unknown 'kid's
+	DefaultMinRefreshInterval = 1 * time.Minute
+
+	// DefaultFetchTimeout bounds a fetch of the key set or revoked list,
+	// lookups needing a refresh wait on it
+	DefaultFetchTimeout = 10 * time.Second
+
+	maxKeySetSize = 1024 * 1024
+)
+
+var UnknownKeyID = errors.New("unknown kid")
+
+// KeyResolver finds the public key for the 'kid' in a token header
+type KeyResolver interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// StaticKey resolves every 'kid' to a single key, see LoadPublicKey
+type StaticKey struct {
+	PublicKey crypto.PublicKey
+}
+
+func (x StaticKey) Key(kid string) (crypto.PublicKey, error) {
+	return x.PublicKey, nil
+}
+
+type KeySetOptions struct {
+	// TTL of fetched keys, defaults to DefaultKeySetTTL
+	TTL time.Duration
+
+	// RefreshInterval of the background refresh, 0 disables it
+	RefreshInterval time.Duration
+
+	// MinRefreshInterval between fetches, defaults to DefaultMinRefreshInterval
+	MinRefreshInterval time.Duration
+
+	// Timeout of a fetch, defaults to DefaultFetchTimeout
+	Timeout time.Duration
+
+	// Client defaults to a client with a DefaultFetchTimeout timeout
+	Client *http.Client
+}
+
+// KeySet is a cached remote JWK set, as published by the server at
+// /.well-known/jwks.json
+type KeySet struct {
+	ctx  context.Context
+	url  string
+	opts KeySetOptions
+	now  func() time.Time
+
+	// fetch serializes requests to the remote set
+	fetch sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]jose.JSONWebKey
+	fetched     time.Time
+	lastAttempt time.Time
+}
+
+// NewKeySet creates a KeySet for url, the background refresh (if
+// enabled) and any fetch in flight stop when ctx is done.
+func NewKeySet(ctx context.Context, url string, opts KeySetOptions) *KeySet {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultKeySetTTL
+	}
+	if opts.MinRefreshInterval <= 0 {
+		opts.MinRefreshInterval = DefaultMinRefreshInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultFetchTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: opts.Timeout}
+	}
+
+	x := &KeySet{
+		ctx:  ctx,
+		url:  url,
+		opts: opts,
+		now:  time.Now,
+		keys: make(map[string]jose.JSONWebKey),
+	}
+
+	if opts.RefreshInterval > 0 {
+		go x.run(ctx)
+	}
+
+	return x
+}
+
+func (x *KeySet) run(ctx context.Context) {
+	ticker := time.NewTicker(x.opts.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// errors are retried on the next tick or lookup
+			_ = x.refresh(true)
+		}
+	}
+}
+
+// Key returns the public key for kid. Stale or unknown keys trigger a
+// fetch, at most once per MinRefreshInterval and bounded by Timeout. If
+// the fetch fails a stale key is still returned.
+func (x *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	key, ok, fresh := x.lookup(kid)
+	if ok && fresh {
+		return key.Key, nil
+	}
+
+	err := x.refresh(false)
+
+	key, ok, _ = x.lookup(kid)
+	if ok {
+		return key.Key, nil
+	}
+
+	if err != nil {
+		return nil, errors.WithMessage(err, "refresh key set")
+	}
+
+	return nil, fmt.Errorf("kid [%s]: %w", kid, UnknownKeyID)
+}
+
+// Refresh fetches the remote set regardless of the rate limit
+func (x *KeySet) Refresh() error {
+	return x.refresh(true)
+}
+
+func (x *KeySet) lookup(kid string) (jose.JSONWebKey, bool, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	key, ok := x.keys[kid]
+	fresh := x.now().Sub(x.fetched) < x.opts.TTL
+	return key, ok, fresh
+}
+
+func (x *KeySet) refresh(force bool) error {
+	x.fetch.Lock()
+	defer x.fetch.Unlock()
+
+	// Checked under the fetch lock so concurrent misses share one request
+	x.mu.Lock()
+	now := x.now()
+	if !force && now.Sub(x.lastAttempt) < x.opts.MinRefreshInterval {
+		x.mu.Unlock()
+		return nil
+	}
+	x.lastAttempt = now
+	x.mu.Unlock()
+
+	keys, err := x.load()
+	if err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	x.keys = keys
+	x.fetched = now
+	x.mu.Unlock()
+
+	return nil
+}
+
+func (x *KeySet) load() (map[string]jose.JSONWebKey, error) {
+	ctx, cancel := context.WithTimeout(x.ctx, x.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, x.url, nil)
+	if err != nil {
+		return nil, errors.WithMessage(err, "key set request")
+	}
+
+	res, err := x.opts.Client.Do(req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get key set")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get key set: unexpected status [%d]", res.StatusCode)
+	}
+
+	var set jose.JSONWebKeySet
+	err = json.NewDecoder(io.LimitReader(res.Body, maxKeySetSize)).Decode(&set)
+	if err != nil {
+		return nil, errors.WithMessage(err, "decode key set")
+	}
+
+	keys := make(map[string]jose.JSONWebKey, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.KeyID == "" || !key.IsPublic() || !key.Valid() {
+			continue
+		}
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		keys[key.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+// StaticKeySet resolves keys from a fixed JWK set, i.e. one pasted into
+// config rather than fetched with KeySet
+type StaticKeySet map[string]crypto.PublicKey
+
+func (x StaticKeySet) Key(kid string) (crypto.PublicKey, error) {
+	key, ok := x[kid]
+	if !ok {
+		return nil, fmt.Errorf("kid [%s]: %w", kid, UnknownKeyID)
+	}
+	return key, nil
+}
+
+// LoadJWKS parses a JWK set as published at /.well-known/jwks.json
+func LoadJWKS(raw []byte) (StaticKeySet, error) {
+	var set jose.JSONWebKeySet
+	err := json.Unmarshal(raw, &set)
+	if err != nil {
+		return nil, errors.WithMessage(err, "decode key set")
+	}
+
+	keys := make(StaticKeySet, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.KeyID == "" || !key.IsPublic() || !key.Valid() {
+			return nil, fmt.Errorf("invalid key [%s]", key.KeyID)
+		}
+		keys[key.KeyID] = key.Key
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,166 @@
+package edge_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/edge"
+	"formation.engineering/oauth2-jwt/server"
+	"formation.engineering/oauth2-jwt/server/admin"
+)
+
+func TestKeySet(t *testing.T) {
+	b := telemetry.NewTestingBuilder(t)
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := server.Config{PrivateKey: serverCreds.PrivateKey}
+
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		set, err := c.JWKS()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	keys := edge.NewKeySet(context.Background(), ts.URL, edge.KeySetOptions{TTL: time.Hour, MinRefreshInterval: time.Minute})
+	edge.SetNow(keys, func() time.Time { return now })
+
+	grant, err := server.Grant(b, c, server.Authorized{TenantID: "tenant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := edge.VerifyKeySet(b, keys, grant.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.TenantID != "tenant" {
+		t.Fatalf("unexpected tenant [%s]", p.TenantID)
+	}
+
+	_, err = edge.VerifyKeySet(b, keys, grant.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatalf("expected cached key set, fetched [%d] times", n)
+	}
+
+	// Unknown kids re-fetch at most once per MinRefreshInterval
+	for i := 0; i < 10; i++ {
+		_, err = keys.Key("unknown")
+		if !errors.Is(err, edge.UnknownKeyID) {
+			t.Fatalf("expected unknown kid, got [%v]", err)
+		}
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatalf("expected rate limited refresh, fetched [%d] times", n)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, _ = keys.Key("unknown")
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Fatalf("expected refresh, fetched [%d] times", n)
+	}
+
+	// Expired keys are re-fetched
+	now = now.Add(2 * time.Hour)
+	_, err = edge.VerifyKeySet(b, keys, grant.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Fatalf("expected refresh, fetched [%d] times", n)
+	}
+}
+
+func TestKeySetUnavailable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	keys := edge.NewKeySet(context.Background(), ts.URL, edge.KeySetOptions{})
+	_, err := keys.Key("kid")
+	if err == nil || errors.Is(err, edge.UnknownKeyID) {
+		t.Fatalf("expected fetch failure, got [%v]", err)
+	}
+}
+
+func TestKeySetSlow(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	keys := edge.NewKeySet(context.Background(), ts.URL, edge.KeySetOptions{Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	_, err := keys.Key("kid")
+	if err == nil || errors.Is(err, edge.UnknownKeyID) {
+		t.Fatalf("expected fetch failure, got [%v]", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the fetch to time out, took [%s]", elapsed)
+	}
+
+	// A cancelled context stops the fetch too
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	keys = edge.NewKeySet(ctx, ts.URL, edge.KeySetOptions{})
+	if err := keys.Refresh(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected [%v] got [%v]", context.Canceled, err)
+	}
+}
+
+func TestLoadJWKS(t *testing.T) {
+	b := telemetry.NewTestingBuilder(t)
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := server.Config{PrivateKey: serverCreds.PrivateKey}
+
+	set, err := c.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := edge.LoadJWKS(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grant, err := server.Grant(b, c, server.Authorized{TenantID: "tenant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = edge.VerifyKeySet(b, keys, grant.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,7 +3,6 @@ package edge
 import (
 	"crypto"
 	"crypto/ecdsa"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -24,7 +23,7 @@ func TokenFromBearer(s string) (string, bool) {
 	return "", false
 }
 
-func VerifyRequest(b telemetry.Builder, key crypto.PublicKey, r *http.Request) (*string, error) {
+func VerifyRequest(b telemetry.Builder, key crypto.PublicKey, r *http.Request) (*Principal, error) {
 	token, ok := TokenFromBearer(r.Header.Get("Authorization"))
 	if !ok {
 		return nil, errors.New("missing header")
@@ -37,54 +36,29 @@ func LoadPublicKey(raw []byte) (*ecdsa.PublicKey, error) {
 	return admin.LoadPublicKey(raw)
 }
 
-func Verify(b telemetry.Builder, key crypto.PublicKey, token string) (*string, error) {
+func Verify(b telemetry.Builder, key crypto.PublicKey, token string) (*Principal, error) {
 	return VerifyWithLeeway(b, key, token, jwt.DefaultLeeway)
 }
 
-func VerifyWithLeeway(b telemetry.Builder, key crypto.PublicKey, token string, leeway time.Duration) (*string, error) {
-	var err error
-	parsedJWT, err := jwt.ParseSigned(token)
-	if err != nil {
-		return nil, errors.WithMessage(err, "parse signed token")
-	}
-
-	type privateClaim struct {
-		Scope []string `json:"scope,omitempty"`
-	}
-
-	var privateClaims privateClaim
-	var verifiedClaims jwt.Claims
-	err = parsedJWT.Claims(key, &verifiedClaims, &privateClaims)
-	if err != nil {
-		return nil, errors.WithMessage(err, "decode claims")
-	}
-
-	expected := jwt.Expected{
-		Issuer:   "formation",
-		Subject:  "",
-		Audience: jwt.Audience{"formation"},
-		ID:       "",
-		Time:     time.Now(),
-	}
-
-	b.String("expiry", verifiedClaims.Expiry.Time().String())
-
-	err = verifiedClaims.ValidateWithLeeway(expected, leeway)
-	if err != nil {
-		return nil, errors.WithMessage(err, "invalid")
-	}
+func VerifyWithLeeway(b telemetry.Builder, key crypto.PublicKey, token string, leeway time.Duration) (*Principal, error) {
+	return VerifyKeySetWithLeeway(b, StaticKey{key}, token, leeway)
+}
 
-	if len(privateClaims.Scope) == 0 {
-		return nil, fmt.Errorf("no private claims decoded")
+// VerifyRequestKeySet is VerifyRequest with the key resolved by 'kid'
+func VerifyRequestKeySet(b telemetry.Builder, keys KeyResolver, r *http.Request) (*Principal, error) {
+	token, ok := TokenFromBearer(r.Header.Get("Authorization"))
+	if !ok {
+		return nil, errors.New("missing header")
 	}
 
-	tenantScope := privateClaims.Scope[0]
-
-	if !strings.HasPrefix(tenantScope, "tenant:") {
-		return nil, fmt.Errorf("malformed tenant scope")
-	}
+	return VerifyKeySet(b, keys, token)
+}
 
-	tenant := strings.TrimPrefix(tenantScope, "tenant:")
+// VerifyKeySet is Verify with the key resolved by the 'kid' token header
+func VerifyKeySet(b telemetry.Builder, keys KeyResolver, token string) (*Principal, error) {
+	return VerifyKeySetWithLeeway(b, keys, token, jwt.DefaultLeeway)
+}
 
-	return &tenant, nil
+func VerifyKeySetWithLeeway(b telemetry.Builder, keys KeyResolver, token string, leeway time.Duration) (*Principal, error) {
+	return Verifier{Keys: keys, Leeway: &leeway}.Verify(b, token)
 }
@@ -0,0 +1,194 @@
+package edge
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"github.com/pkg/errors"
+)
+
+// RFC 6750 error codes
+// https://tools.ietf.org/html/rfc6750#section-3.1
+const (
+	invalidRequest    = "invalid_request"
+	invalidToken      = "invalid_token"
+	insufficientScope = "insufficient_scope"
+)
+
+// BearerError is a failed bearer token check, Code is empty when the
+// request carried no credentials at all.
+type BearerError struct {
+	Code        string
+	Description string
+	// Scope required by the resource, for 'insufficient_scope'
+	Scope []string
+	Err   error
+}
+
+func (x *BearerError) Error() string {
+	msg := x.ClientMessage()
+	if x.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, x.Err)
+	}
+	return msg
+}
+
+// ClientMessage is the error code and description, without the wrapped
+// error which may reveal key fetch failures
+func (x *BearerError) ClientMessage() string {
+	msg := x.Code
+	if msg == "" {
+		msg = "unauthorized"
+	}
+	if x.Description != "" {
+		msg = fmt.Sprintf("%s: %s", msg, x.Description)
+	}
+	return msg
+}
+
+func (x *BearerError) Unwrap() error {
+	return x.Err
+}
+
+func (x *BearerError) StatusCode() int {
+	switch x.Code {
+	case invalidRequest:
+		return http.StatusBadRequest
+	case insufficientScope:
+		return http.StatusForbidden
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+// Challenge is the WWW-Authenticate header value
+// https://tools.ietf.org/html/rfc6750#section-3
+func (x *BearerError) Challenge(realm string) string {
+	var params []string
+	if realm != "" {
+		params = append(params, fmt.Sprintf(`realm="%s"`, quote(realm)))
+	}
+	if x.Code != "" {
+		params = append(params, fmt.Sprintf(`error="%s"`, x.Code))
+	}
+	if x.Code != "" && x.Description != "" {
+		params = append(params, fmt.Sprintf(`error_description="%s"`, quote(x.Description)))
+	}
+	if len(x.Scope) > 0 {
+		params = append(params, fmt.Sprintf(`scope="%s"`, quote(strings.Join(x.Scope, " "))))
+	}
+
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+func quote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+type MiddlewareOptions struct {
+	// Keys resolves the server key, see KeySet and StaticKey
+	Keys KeyResolver
+
+	// NewBuilder creates the telemetry builder for a request, it is pushed
+	// once the request completes. Defaults to a no-op builder.
+	NewBuilder func() telemetry.Builder
+
+	// Realm is included in challenges when set
+	Realm string
+
+	// RequiredScopes must all be granted to the token
+	RequiredScopes []string
+
+	// Leeway defaults to jwt.DefaultLeeway
+	Leeway *time.Duration
+
+	// DenyList of revoked tokens, optional
+	DenyList DenyList
+
+	// Issuer and Audience expected in the token, see Verifier
+	Issuer   string
+	Audience string
+
+	// ErrorWriter defaults to WriteBearerError
+	ErrorWriter func(w http.ResponseWriter, r *http.Request, err *BearerError)
+}
+
+// Middleware verifies the bearer token of every request and passes the
+// verified Principal to the next handler, see PrincipalFromContext.
+func Middleware(opts MiddlewareOptions) func(http.Handler) http.Handler {
+	if opts.NewBuilder == nil {
+		opts.NewBuilder = func() telemetry.Builder { return telemetry.NewBuilder(&telemetry.NoOp{}) }
+	}
+	writeError := opts.ErrorWriter
+	if writeError == nil {
+		writeError = func(w http.ResponseWriter, r *http.Request, err *BearerError) {
+			WriteBearerError(w, opts.Realm, err)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b := opts.NewBuilder()
+			defer b.Push()
+
+			p, err := Authenticate(b, opts, r.Header.Get("Authorization"))
+			if err != nil {
+				b.Bool("authorization_failure", true)
+				b.String("authorization_failure_message", err.Error())
+				writeError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// Authenticate verifies an Authorization header value against opts, it
+// is shared by Middleware and the grpc interceptors.
+func Authenticate(b telemetry.Builder, opts MiddlewareOptions, header string) (*Principal, *BearerError) {
+	if header == "" {
+		return nil, &BearerError{}
+	}
+
+	token, ok := TokenFromBearer(header)
+	if !ok {
+		return nil, &BearerError{Code: invalidRequest, Description: "malformed authorization header"}
+	}
+
+	verifier := Verifier{
+		Keys:     opts.Keys,
+		Leeway:   opts.Leeway,
+		DenyList: opts.DenyList,
+		Issuer:   opts.Issuer,
+		Audience: opts.Audience,
+	}
+
+	p, err := verifier.Verify(b, token)
+	if errors.Is(err, Revoked) {
+		return nil, &BearerError{Code: invalidToken, Description: "the access token was revoked", Err: err}
+	} else if err != nil {
+		return nil, &BearerError{Code: invalidToken, Description: "the access token is invalid", Err: err}
+	}
+
+	err = RequireScope(p.Scopes, opts.RequiredScopes...)
+	if errors.Is(err, InsufficientScope) {
+		return nil, &BearerError{Code: insufficientScope, Scope: opts.RequiredScopes, Err: err}
+	} else if err != nil {
+		return nil, &BearerError{Code: invalidToken, Err: err}
+	}
+
+	return p, nil
+}
+
+// WriteBearerError sends the challenge and status code for err
+func WriteBearerError(w http.ResponseWriter, realm string, err *BearerError) {
+	w.Header().Set("WWW-Authenticate", err.Challenge(realm))
+	w.WriteHeader(err.StatusCode())
+}
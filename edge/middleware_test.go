@@ -0,0 +1,96 @@
+package edge_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/edge"
+	"formation.engineering/oauth2-jwt/server"
+	"formation.engineering/oauth2-jwt/server/admin"
+)
+
+func TestMiddleware(t0 *testing.T) {
+	b := telemetry.NewTestingBuilder(t0)
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t0.Fatal(err)
+	}
+	c := server.Config{PrivateKey: serverCreds.PrivateKey}
+
+	grant, err := server.Grant(b, c, server.Authorized{TenantID: "tenant", Scopes: []string{"read"}})
+	if err != nil {
+		t0.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, found := edge.PrincipalFromContext(r.Context())
+		if !found || p.TenantID != "tenant" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(opts edge.MiddlewareOptions, header string) *httptest.ResponseRecorder {
+		opts.Keys = edge.StaticKey{serverCreds.PublicKey}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		edge.Middleware(opts)(ok).ServeHTTP(w, r)
+		return w
+	}
+
+	check := func(t *testing.T, w *httptest.ResponseRecorder, code int, challenge string) {
+		if w.Code != code {
+			t.Fatalf("status = %d; want %d", w.Code, code)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); got != challenge {
+			t.Fatalf("challenge = %q; want %q", got, challenge)
+		}
+	}
+
+	t0.Run("success", func(t *testing.T) {
+		check(t, serve(edge.MiddlewareOptions{RequiredScopes: []string{"read"}}, "Bearer "+grant.Token), http.StatusOK, "")
+	})
+
+	t0.Run("missing", func(t *testing.T) {
+		check(t, serve(edge.MiddlewareOptions{Realm: "api"}, ""), http.StatusUnauthorized, `Bearer realm="api"`)
+	})
+
+	t0.Run("malformed", func(t *testing.T) {
+		check(t, serve(edge.MiddlewareOptions{}, "Basic abc"), http.StatusBadRequest, `Bearer error="invalid_request", error_description="malformed authorization header"`)
+	})
+
+	t0.Run("invalid", func(t *testing.T) {
+		check(t, serve(edge.MiddlewareOptions{}, "Bearer invalid"), http.StatusUnauthorized, `Bearer error="invalid_token", error_description="the access token is invalid"`)
+	})
+
+	t0.Run("scope", func(t *testing.T) {
+		check(t, serve(edge.MiddlewareOptions{RequiredScopes: []string{"read", "admin"}}, "Bearer "+grant.Token), http.StatusForbidden, `Bearer error="insufficient_scope", scope="read admin"`)
+	})
+
+	t0.Run("revoked", func(t *testing.T) {
+		p, err := edge.VerifyKeySet(b, edge.StaticKey{serverCreds.PublicKey}, grant.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deny := edge.NewMemoryDenyList(0, 0)
+		if err := deny.Add(p.TenantID, p.TokenID, p.Expiry); err != nil {
+			t.Fatal(err)
+		}
+		check(t, serve(edge.MiddlewareOptions{DenyList: deny}, "Bearer "+grant.Token), http.StatusUnauthorized, `Bearer error="invalid_token", error_description="the access token was revoked"`)
+	})
+
+	t0.Run("error writer", func(t *testing.T) {
+		opts := edge.MiddlewareOptions{
+			ErrorWriter: func(w http.ResponseWriter, r *http.Request, err *edge.BearerError) {
+				w.WriteHeader(http.StatusTeapot)
+			},
+		}
+		check(t, serve(opts, ""), http.StatusTeapot, "")
+	})
+}
@@ -0,0 +1,41 @@
+package edge
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"formation.engineering/library/lib/telemetry/v1"
+)
+
+// Principal is the verified caller of a request
+type Principal struct {
+	TenantID string
+	// IdentityID ('sub') and KeyID of the API key that requested the token
+	IdentityID string
+	KeyID      string
+	Scopes     Scopes
+	IssuedAt   time.Time
+	Expiry     time.Time
+	// TokenID is the 'jti' of the token
+	TokenID string
+}
+
+func (x Principal) Event(b telemetry.Builder) {
+	b.String("tenant_id", x.TenantID)
+	b.String("identity_id", x.IdentityID)
+	b.String("key_id", x.KeyID)
+	b.String("token_id", x.TokenID)
+	b.String("scope", strings.Join(x.Scopes, " "))
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
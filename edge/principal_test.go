@@ -0,0 +1,62 @@
+package edge_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/edge"
+	"formation.engineering/oauth2-jwt/server"
+	"formation.engineering/oauth2-jwt/server/admin"
+)
+
+func TestPrincipal(t *testing.T) {
+	b := telemetry.NewTestingBuilder(t)
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := server.Config{PrivateKey: serverCreds.PrivateKey}
+
+	grant, err := server.Grant(b, c, server.Authorized{
+		TenantID:   "tenant",
+		IdentityID: "identity",
+		KeyID:      "key",
+		Scopes:     []string{"read"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := edge.Verify(b, serverCreds.PublicKey, grant.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.TenantID != "tenant" || p.IdentityID != "identity" || p.KeyID != "key" {
+		t.Fatalf("unexpected principal %v", *p)
+	}
+	if !p.Scopes.Has("read") || !p.Scopes.Has("tenant:tenant") {
+		t.Fatalf("unexpected scopes %v", p.Scopes)
+	}
+	if p.TokenID == "" {
+		t.Fatal("missing token id")
+	}
+	if d := p.Expiry.Sub(p.IssuedAt); d != server.GrantDuration {
+		t.Fatalf("unexpected lifetime [%s]", d)
+	}
+	if time.Since(p.IssuedAt) > time.Minute {
+		t.Fatalf("unexpected issued at [%s]", p.IssuedAt)
+	}
+
+	_, ok := edge.PrincipalFromContext(context.Background())
+	if ok {
+		t.Fatal("unexpected principal in empty context")
+	}
+
+	out, ok := edge.PrincipalFromContext(edge.WithPrincipal(context.Background(), p))
+	if !ok || out != p {
+		t.Fatal("expected principal from context")
+	}
+}
@@ -0,0 +1,51 @@
+package edge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const tenantScope = "tenant:"
+
+var InsufficientScope = errors.New("insufficient_scope")
+
+// Scopes granted to a token, the tenant scope is always present
+type Scopes []string
+
+// Tenant is the id from the 'tenant:<id>' scope, empty when there is none
+// or more than one
+func (x Scopes) Tenant() string {
+	tenant, found := "", false
+	for _, s := range x {
+		if !strings.HasPrefix(s, tenantScope) {
+			continue
+		}
+		if found {
+			return ""
+		}
+		tenant, found = strings.TrimPrefix(s, tenantScope), true
+	}
+	return tenant
+}
+
+func (x Scopes) Has(scope string) bool {
+	for _, s := range x {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope fails unless every required scope was granted
+// https://tools.ietf.org/html/rfc6750#section-3.1
+func RequireScope(scopes Scopes, required ...string) error {
+	for _, r := range required {
+		if !scopes.Has(r) {
+			return fmt.Errorf("missing scope [%s]: %w", r, InsufficientScope)
+		}
+	}
+	return nil
+}
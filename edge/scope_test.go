@@ -0,0 +1,30 @@
+package edge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScopes(t *testing.T) {
+	scopes := Scopes{"read", "tenant:1234", "write"}
+
+	if scopes.Tenant() != "1234" {
+		t.Fatalf("unexpected tenant [%s]", scopes.Tenant())
+	}
+
+	if err := RequireScope(scopes, "read", "write"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RequireScope(scopes, "read", "admin"); !errors.Is(err, InsufficientScope) {
+		t.Fatalf("expected insufficient scope got [%v]", err)
+	}
+
+	if (Scopes{"read"}).Tenant() != "" {
+		t.Fatal("unexpected tenant")
+	}
+
+	if (Scopes{"tenant:1234", "tenant:other"}).Tenant() != "" {
+		t.Fatal("unexpected tenant of two tenant scopes")
+	}
+}
@@ -0,0 +1,117 @@
+package edge
+
+import (
+	"fmt"
+	"time"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"github.com/pkg/errors"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	// DefaultIssuer and DefaultAudience of tokens issued by the server
+	DefaultIssuer   = "formation"
+	DefaultAudience = "formation"
+)
+
+// Verifier checks tokens issued by the server
+type Verifier struct {
+	// Keys resolves the server key, see KeySet and StaticKey
+	Keys KeyResolver
+
+	// Leeway defaults to jwt.DefaultLeeway
+	Leeway *time.Duration
+
+	// DenyList of revoked tokens, optional
+	DenyList DenyList
+
+	// Issuer and Audience expected in the token, must match the server
+	// config, default to DefaultIssuer and DefaultAudience
+	Issuer   string
+	Audience string
+}
+
+// Verify checks the token signature, registered claims and the deny list
+func (x Verifier) Verify(b telemetry.Builder, token string) (*Principal, error) {
+	leeway := jwt.DefaultLeeway
+	if x.Leeway != nil {
+		leeway = *x.Leeway
+	}
+
+	var err error
+	parsedJWT, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, errors.WithMessage(err, "parse signed token")
+	}
+
+	kid := parsedJWT.Headers[0].KeyID
+	b.String("server_key_id", kid)
+
+	key, err := x.Keys.Key(kid)
+	if err != nil {
+		return nil, errors.WithMessage(err, "resolve key")
+	}
+
+	// see server.PrivateClaims
+	type privateClaim struct {
+		Scope []string `json:"scope,omitempty"`
+		KeyID string   `json:"key_id,omitempty"`
+	}
+
+	var privateClaims privateClaim
+	var verifiedClaims jwt.Claims
+	err = parsedJWT.Claims(key, &verifiedClaims, &privateClaims)
+	if err != nil {
+		return nil, errors.WithMessage(err, "decode claims")
+	}
+
+	expected := jwt.Expected{
+		Issuer:   orDefault(x.Issuer, DefaultIssuer),
+		Subject:  "",
+		Audience: jwt.Audience{orDefault(x.Audience, DefaultAudience)},
+		ID:       "",
+		Time:     time.Now(),
+	}
+
+	b.String("expiry", verifiedClaims.Expiry.Time().String())
+
+	err = verifiedClaims.ValidateWithLeeway(expected, leeway)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid")
+	}
+
+	if len(privateClaims.Scope) == 0 {
+		return nil, fmt.Errorf("no private claims decoded")
+	}
+
+	scopes := Scopes(privateClaims.Scope)
+	if scopes.Tenant() == "" {
+		return nil, fmt.Errorf("malformed tenant scope")
+	}
+
+	p := Principal{
+		TenantID:   scopes.Tenant(),
+		IdentityID: verifiedClaims.Subject,
+		KeyID:      privateClaims.KeyID,
+		Scopes:     scopes,
+		IssuedAt:   verifiedClaims.IssuedAt.Time(),
+		Expiry:     verifiedClaims.Expiry.Time(),
+		TokenID:    verifiedClaims.ID,
+	}
+	p.Event(b)
+
+	if x.DenyList != nil && x.DenyList.Revoked(p.TenantID, p.TokenID) {
+		b.Bool("token_revoked", true)
+		return nil, fmt.Errorf("token [%s]: %w", p.TokenID, Revoked)
+	}
+
+	return &p, nil
+}
+
+func orDefault(s, d string) string {
+	if s == "" {
+		return d
+	}
+	return s
+}
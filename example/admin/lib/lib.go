@@ -24,18 +24,18 @@ func Setup(b telemetry.Builder) (interface{}, error) {
 		return nil, err
 	}
 
-	stateTable, err := env.Lookup("STATE_TABLE_NAME", "authorization")
+	keysTable, err := env.Lookup("KEYS_TABLE_NAME", "authorization")
 	if err != nil {
 		return nil, err
 	}
 
-	keysTable, err := env.Lookup("KEYS_TABLE_NAME", "authorization")
+	identitiesTable, err := env.Lookup("IDENTITIES_TABLE_NAME", "authorization")
 	if err != nil {
 		return nil, err
 	}
 
 	c := Config{
-		Store: dynamodb.NewStore(*region, *stateTable, *keysTable),
+		Store: dynamodb.NewStore(*region, *keysTable, *identitiesTable),
 	}
 	return c, nil
 }
@@ -74,20 +74,74 @@ func Run(
 			TenantName:      input.TenantName,
 			ApplicationName: input.ApplicationName,
 			CreatedBy:       input.CreatedBy,
+			Scopes:          input.Scopes,
+			Policy:          input.Policy.keyPolicy(),
+			ExpiresAt:       input.ExpiresAt,
 		}
 
 		creds, err := client.NewCredentials(b, cfg.Store, client.RSAGenerator{}, clientReq)
+		if errors.Is(err, store.Conflict) || errors.Is(err, client.ReservedScope) {
+			return encodeParseError(err)
+		}
+		if err != nil {
+			return encodeInternalError(err)
+		}
+		return encodeCredentials(creds)
+	}
+
+	if req.AddKey != nil {
+		input := *req.AddKey
+		if input.IdentityID == "" {
+			return encodeParseError(errors.New("identity_id must not be empty"))
+		}
+		if input.CreatedBy == "" {
+			return encodeParseError(errors.New("created_by must not be empty"))
+		}
+
+		clientReq := client.Request{
+			CreatedBy: input.CreatedBy,
+			Scopes:    input.Scopes,
+			Policy:    input.Policy.keyPolicy(),
+			ExpiresAt: input.ExpiresAt,
+		}
+
+		creds, err := client.AddCredentials(b, cfg.Store, client.RSAGenerator{}, input.IdentityID, clientReq)
+		if errors.Is(err, store.NotFound) || errors.Is(err, store.Conflict) || errors.Is(err, client.ReservedScope) {
+			return encodeParseError(err)
+		}
 		if err != nil {
 			return encodeInternalError(err)
 		}
+		return encodeCredentials(creds)
+	}
+
+	if req.GetIdentity != nil {
+		input := *req.GetIdentity
+		if input.IdentityID == "" {
+			return encodeParseError(errors.New("identity_id must not be empty"))
+		}
+
+		identity, err := cfg.Store.GetIdentity(input.IdentityID)
+		if err != nil {
+			return encodeInternalError(err)
+		}
+		if identity == nil {
+			return encodeParseError(fmt.Errorf("identity [%s]: %w", input.IdentityID, store.NotFound))
+		}
+
 		output := struct {
-			StatusCode int64          `json:"statusCode"`
-			Body       CreateResponse `json:"body"`
+			StatusCode int64    `json:"statusCode"`
+			Body       Identity `json:"body"`
 		}{
 			StatusCode: 200,
-			Body: CreateResponse{
-				KeyID:      (*creds).KeyID,
-				PrivateKey: (*creds).PrivateKey,
+			Body: Identity{
+				IdentityID:      identity.IdentityID,
+				TenantID:        identity.TenantID,
+				TenantName:      identity.TenantName,
+				ApplicationName: identity.ApplicationName,
+				CreatedBy:       identity.CreatedBy,
+				Created:         identity.Created,
+				KeyIDs:          identity.KeyIDs,
 			},
 		}
 		bytes, err := json.Marshal(output)
@@ -107,9 +161,177 @@ func Run(
 		return nil, err
 	}
 
+	if req.ListKeys != nil {
+		input := *req.ListKeys
+		if input.TenantID == "" {
+			return encodeParseError(errors.New("tenant_id must not be empty"))
+		}
+
+		page, err := cfg.Store.ListKeys(input.TenantID, store.Page{Limit: input.Limit, Cursor: input.Cursor})
+		if err != nil {
+			return encodeInternalError(err)
+		}
+
+		body := ListResponse{Keys: make([]KeyMetadata, 0, len(page.Keys)), Next: page.Next}
+		for _, k := range page.Keys {
+			body.Keys = append(body.Keys, KeyMetadata{
+				KeyID:           k.KeyID,
+				IdentityID:      k.IdentityID,
+				ApplicationName: k.ApplicationName,
+				CreatedBy:       k.CreatedBy,
+				Created:         k.Created,
+				Status:          string(k.Status),
+			})
+		}
+
+		output := struct {
+			StatusCode int64        `json:"statusCode"`
+			Body       ListResponse `json:"body"`
+		}{
+			StatusCode: 200,
+			Body:       body,
+		}
+		bytes, err := json.Marshal(output)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal response")
+		}
+		return bytes, nil
+	}
+
+	if req.GetKey != nil {
+		input := *req.GetKey
+		if input.KeyID == "" {
+			return encodeParseError(errors.New("key_id must not be empty"))
+		}
+
+		meta, err := cfg.Store.GetKeyMetadata(input.KeyID)
+		if err != nil {
+			return encodeInternalError(err)
+		}
+		if meta == nil {
+			return encodeParseError(fmt.Errorf("key [%s]: %w", input.KeyID, store.NotFound))
+		}
+
+		body := KeyDetail{
+			KeyMetadata: KeyMetadata{
+				KeyID:           meta.KeyID,
+				IdentityID:      meta.IdentityID,
+				ApplicationName: meta.ApplicationName,
+				CreatedBy:       meta.CreatedBy,
+				Created:         meta.Created,
+				Status:          string(meta.Status),
+			},
+			TenantID:        meta.TenantID,
+			TenantName:      meta.TenantName,
+			Scopes:          meta.Scopes,
+			ExpiresAt:       timeOrNil(meta.ExpiresAt),
+			LastUsed:        timeOrNil(meta.LastUsed),
+			UseCount:        meta.UseCount,
+			StatusChangedAt: timeOrNil(meta.StatusChangedAt),
+			StatusChangedBy: meta.StatusChangedBy,
+			StatusReason:    meta.StatusReason,
+		}
+		if meta.Policy != nil {
+			body.Policy = &Policy{
+				MaxLifetime: int64(meta.Policy.MaxLifetime / time.Second),
+				Audiences:   meta.Policy.Audiences,
+				Scopes:      meta.Policy.Scopes,
+			}
+		}
+
+		output := struct {
+			StatusCode int64     `json:"statusCode"`
+			Body       KeyDetail `json:"body"`
+		}{
+			StatusCode: 200,
+			Body:       body,
+		}
+		bytes, err := json.Marshal(output)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal response")
+		}
+		return bytes, nil
+	}
+
+	if req.MigrateIdentities != nil {
+		dyn, ok := cfg.Store.(*dynamodb.DynamoStore)
+		if !ok {
+			return encodeParseError(errors.New("migrate-identities requires the dynamodb store"))
+		}
+
+		count, err := dyn.MigrateIdentities()
+		if err != nil {
+			return encodeInternalError(err)
+		}
+
+		output := struct {
+			StatusCode int64           `json:"statusCode"`
+			Body       MigrateResponse `json:"body"`
+		}{
+			StatusCode: 200,
+			Body:       MigrateResponse{Keys: count},
+		}
+		bytes, err := json.Marshal(output)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal response")
+		}
+		return bytes, nil
+	}
+
+	if req.SetKeyStatus != nil {
+		input := *req.SetKeyStatus
+		if input.KeyID == "" {
+			return encodeParseError(errors.New("key_id must not be empty"))
+		}
+		if input.ChangedBy == "" {
+			return encodeParseError(errors.New("changed_by must not be empty"))
+		}
+
+		change := store.StatusChange{
+			Status:    store.KeyStatus(input.Status),
+			ChangedBy: input.ChangedBy,
+			Reason:    input.Reason,
+		}
+		if !change.Status.Valid() {
+			return encodeParseError(errors.New("status must be one of active, disabled or revoked"))
+		}
+
+		err := cfg.Store.SetKeyStatus(input.KeyID, change)
+		if errors.Is(err, store.NotFound) || errors.Is(err, store.AlreadyRevoked) {
+			return encodeParseError(err)
+		}
+		return nil, err
+	}
+
 	return encodeParseError(errors.New("no request was specified"))
 }
 
+func encodeCredentials(creds *client.Credentials) (json.RawMessage, error) {
+	output := struct {
+		StatusCode int64          `json:"statusCode"`
+		Body       CreateResponse `json:"body"`
+	}{
+		StatusCode: 200,
+		Body: CreateResponse{
+			KeyID:      creds.KeyID,
+			IdentityID: creds.IdentityID,
+			PrivateKey: creds.PrivateKey,
+		},
+	}
+	bytes, err := json.Marshal(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+	return bytes, nil
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 func encodeParseError(err error) (json.RawMessage, error) {
 	result := struct {
 		StatusCode int64  `json:"statusCode"`
@@ -147,27 +369,129 @@ type Request struct {
 	//	ListApplication   string `json:"list-application"`
 	//	UpdateApplication string `json:"list-application"`
 	//	DeleteApplication string `json:"create-application"`
-	//	List   *ListRequest   `json:"list-keys"`
-	CreateKey *CreateRequest `json:"create-key"`
-	DeleteKey *DeleteRequest `json:"delete-key"`
+	ListKeys          *ListRequest      `json:"list-keys"`
+	GetKey            *GetRequest       `json:"get-key"`
+	CreateKey         *CreateRequest    `json:"create-key"`
+	AddKey            *AddKeyRequest    `json:"add-key"`
+	GetIdentity       *IdentityRequest  `json:"get-identity"`
+	DeleteKey         *DeleteRequest    `json:"delete-key"`
+	SetKeyStatus      *SetStatusRequest `json:"set-key-status"`
+	MigrateIdentities *struct{}         `json:"migrate-identities"`
 }
 
 type CreateRequest struct {
-	TenantID        string `json:"tenant_id"`
-	TenantName      string `json:"tenant_name"`
-	ApplicationName string `json:"application_name"`
-	CreatedBy       string `json:"created_by"`
+	TenantID        string   `json:"tenant_id"`
+	TenantName      string   `json:"tenant_name"`
+	ApplicationName string   `json:"application_name"`
+	CreatedBy       string   `json:"created_by"`
+	Scopes          []string `json:"scopes"`
+	Policy          *Policy  `json:"policy"`
+	// ExpiresAt is RFC 3339, optional
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AddKeyRequest adds a key to an existing identity, to rotate keys
+type AddKeyRequest struct {
+	IdentityID string   `json:"identity_id"`
+	CreatedBy  string   `json:"created_by"`
+	Scopes     []string `json:"scopes"`
+	Policy     *Policy  `json:"policy"`
+	// ExpiresAt is RFC 3339, optional
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type Policy struct {
+	MaxLifetime int64    `json:"max_lifetime"` // seconds
+	Audiences   []string `json:"audiences"`
+	Scopes      []string `json:"scopes"`
+}
+
+func (x *Policy) keyPolicy() *store.KeyPolicy {
+	if x == nil {
+		return nil
+	}
+	return &store.KeyPolicy{
+		MaxLifetime: time.Duration(x.MaxLifetime) * time.Second,
+		Audiences:   x.Audiences,
+		Scopes:      x.Scopes,
+	}
 }
 
 type CreateResponse struct {
 	KeyID      string `json:"key_id"`
+	IdentityID string `json:"identity_id"`
 	PrivateKey []byte `json:"private_key"`
 }
 
+type MigrateResponse struct {
+	// Keys scanned, each added to its identity
+	Keys int `json:"keys"`
+}
+
+type IdentityRequest struct {
+	IdentityID string `json:"identity_id"`
+}
+
+type Identity struct {
+	IdentityID      string    `json:"identity_id"`
+	TenantID        string    `json:"tenant_id"`
+	TenantName      string    `json:"tenant_name"`
+	ApplicationName string    `json:"application_name"`
+	CreatedBy       string    `json:"created_by"`
+	Created         time.Time `json:"created"`
+	KeyIDs          []string  `json:"key_ids"`
+}
+
 type DeleteRequest struct {
 	KeyID string `json:"key_id"`
 }
 
+type ListRequest struct {
+	TenantID string `json:"tenant_id"`
+	Limit    int    `json:"limit"`
+	Cursor   string `json:"cursor"`
+}
+
+type ListResponse struct {
+	Keys []KeyMetadata `json:"keys"`
+	Next string        `json:"next,omitempty"`
+}
+
+type KeyMetadata struct {
+	KeyID           string    `json:"key_id"`
+	IdentityID      string    `json:"identity_id"`
+	ApplicationName string    `json:"application_name"`
+	CreatedBy       string    `json:"created_by"`
+	Created         time.Time `json:"created"`
+	Status          string    `json:"status"`
+}
+
+type GetRequest struct {
+	KeyID string `json:"key_id"`
+}
+
+// KeyDetail is everything stored for a key but the public key
+type KeyDetail struct {
+	KeyMetadata
+	TenantID        string     `json:"tenant_id"`
+	TenantName      string     `json:"tenant_name"`
+	Scopes          []string   `json:"scopes,omitempty"`
+	Policy          *Policy    `json:"policy,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	LastUsed        *time.Time `json:"last_used,omitempty"`
+	UseCount        int64      `json:"use_count"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	StatusChangedBy string     `json:"status_changed_by,omitempty"`
+	StatusReason    string     `json:"status_reason,omitempty"`
+}
+
+type SetStatusRequest struct {
+	KeyID     string `json:"key_id"`
+	Status    string `json:"status"`
+	ChangedBy string `json:"changed_by"`
+	Reason    string `json:"reason"`
+}
+
 type APIKey struct {
 	//	APIKeyMetadata
 }
@@ -3,7 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"formation.engineering/library/lib/env"
 	"formation.engineering/library/lib/lambda/v2"
@@ -36,7 +40,13 @@ func setup(b telemetry.Builder) (interface{}, error) {
 		return nil, err
 	}
 
-	privateKey, err := admin.LoadPrivateKey([]byte(*rawPrivateKey))
+	// Either a single PEM or a key ring mid rotation
+	ring, err := admin.LoadKeyRing([]byte(*rawPrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	serverConfig, err := server.ConfigFromKeyRing(*ring)
 	if err != nil {
 		return nil, err
 	}
@@ -51,15 +61,43 @@ func setup(b telemetry.Builder) (interface{}, error) {
 		return nil, err
 	}
 
+	serverConfig.MaxAssertionLifetime = time.Hour
+	serverConfig.RequiredClaims = []string{"iat", "exp"}
+
+	// Optional, rejects replayed assertions when configured
+	if replayTable, ok := os.LookupEnv("ASSERTIONS_TABLE_NAME"); ok {
+		serverConfig.Replay = dynamodb.NewReplayCache(*region, replayTable)
+	}
+
+	// disabled keys are accepted for up to the cache TTL, the admin
+	// lambda can't invalidate this cache
+	keys := store.Cached(dynamodb.NewReadOnlyStore(*region, *keysTable), store.CacheOptions{})
+	flushUsageOnExit(keys)
+
 	c := Config{
-		Config: server.Config{
-			PrivateKey: privateKey,
-		},
-		Store: dynamodb.NewReadOnlyStore(*region, *keysTable),
+		Config: *serverConfig,
+		Store:  keys,
 	}
 	return c, nil
 }
 
+// flushUsageOnExit writes the key usage held back by the throttle on
+// SIGTERM. Lambda only sends it when an extension is registered, without
+// one the held back uses are lost when the environment is recycled.
+func flushUsageOnExit(x store.UsageFlusher) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM)
+
+	go func() {
+		<-sig
+		err := x.FlushUsage()
+		if err != nil {
+			log.Printf("flush usage: %v", err)
+		}
+		os.Exit(0)
+	}()
+}
+
 func handler(
 	ienv interface{},
 	ctx context.Context,
@@ -78,16 +116,16 @@ func runner(cfg Config) func(context.Context, telemetry.Builder, Unauthenticated
 	return func(ctx context.Context, b telemetry.Builder, req UnauthenticatedRequest) Response {
 
 		res, err := server.AuthorizationGrant(b, cfg.Config, cfg.Store, req.Body)
-		if errors.Is(err, server.NotAuthorized) {
-			b.Bool("unauthorized", true)
-			b.String("unauthorized_error", err.Error())
-			return Forbidden()
-		}
-
 		if err != nil {
-			b.Bool("error", true)
-			b.String("error_message", err.Error())
-			return Forbidden()
+			oerr := server.AsError(err)
+			if oerr.Code == server.ServerError {
+				b.Bool("error", true)
+				b.String("error_message", err.Error())
+			} else {
+				b.Bool("unauthorized", true)
+				b.String("unauthorized_error", err.Error())
+			}
+			return Error(oerr.StatusCode(), string(oerr.Body()))
 		}
 
 		return Ok(string(res))
@@ -15,6 +15,18 @@ func Forbidden() Response {
 	}
 }
 
+// Error is an OAuth 2.0 error response, see server.ErrorResponse
+func Error(code int, payload string) Response {
+	return Response{
+		StatusCode: code,
+		Headers: map[string]string{
+			"Content-Type":  "application/json",
+			"Cache-Control": "no-store",
+		},
+		Body: payload,
+	}
+}
+
 func Ok(payload string) Response {
 	return Response{
 		StatusCode: 200,
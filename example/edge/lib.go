@@ -16,6 +16,7 @@ import (
 
 type Request struct {
 	TenantID       string
+	Principal      edge.Principal
 	Headers        map[string]string
 	Body           string
 	PathParameters map[string]string
@@ -53,13 +54,13 @@ func tryHTTPGateway(
 	}
 
 	var err error
-	var tenant *string
+	var principal *edge.Principal
 
 	b.Timed("authorize_duration_ms", func() {
 		if oauthExpiryLeeway != nil {
-			tenant, err = edge.VerifyWithLeeway(b, key, token, *oauthExpiryLeeway)
+			principal, err = edge.VerifyWithLeeway(b, key, token, *oauthExpiryLeeway)
 		} else {
-			tenant, err = edge.Verify(b, key, token)
+			principal, err = edge.Verify(b, key, token)
 		}
 	})
 
@@ -84,7 +85,8 @@ func tryHTTPGateway(
 	}
 
 	req := Request{
-		TenantID:       *tenant,
+		TenantID:       principal.TenantID,
+		Principal:      *principal,
 		Headers:        headers,
 		Body:           body,
 		PathParameters: request.PathParameters,
@@ -5,7 +5,9 @@ go 1.14
 require (
 	formation.engineering/library v0.0.0-20200801040600-c799be78b6b1
 	github.com/aws/aws-sdk-go v1.31.15
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/pkg/errors v0.9.1
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	google.golang.org/grpc v1.31.0
 	gopkg.in/square/go-jose.v2 v2.4.1
 )
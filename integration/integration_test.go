@@ -3,8 +3,6 @@ package integrations
 
 import (
 	"context"
-	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -29,7 +27,7 @@ func TestAuthFlow(t *testing.T) {
 		t.Skip("skipping dynamo test")
 	}
 	t.Run("dynamodb", func(y *testing.T) {
-		flow(y, dynamodb.NewStore("us-west-2", "ci-test-state", "ci-test-gator-keys"))
+		flow(y, dynamodb.NewStore("us-west-2", "ci-test-gator-keys", "ci-test-gator-identities"))
 	})
 }
 
@@ -47,28 +45,18 @@ func flow(t *testing.T, xstore store.Store) {
 		t.Fatal(err)
 	}
 
-	c := token.Config{privateKey}
+	c := token.Config{PrivateKey: privateKey}
 	tenant := "fake-tenant"
 
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			fmt.Println(err.Error())
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-		res, err := token.AuthorizationGrant(b, c, xstore, string(body))
-		if err != nil {
-			//			fmt.Println(err.Error())
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(res)
-	}))
+	ts := httptest.NewServer(token.NewServeMux(func() telemetry.Builder { return b }, c, xstore))
 	defer ts.Close()
 
-	req := server.Request{tenant, "name", "application", "darren"}
+	req := server.Request{
+		TenantID:        tenant,
+		TenantName:      "name",
+		ApplicationName: "application",
+		CreatedBy:       "darren",
+	}
 	creds, err := server.NewCredentials(b, xstore, server.TestRSAGenerator{}, req)
 	if err != nil {
 		log.Fatal(err.Error())
@@ -104,20 +92,28 @@ func flow(t *testing.T, xstore store.Store) {
 	}
 
 	// Define test edge service
-	xs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		out, err := edge.VerifyRequest(b, publicKey, r)
-		if err != nil {
-			fmt.Println(err.Error())
-			w.WriteHeader(http.StatusUnauthorized)
+	verify := edge.Middleware(edge.MiddlewareOptions{
+		Keys:       edge.StaticKey{PublicKey: publicKey},
+		NewBuilder: func() telemetry.Builder { return b },
+	})
+	xs := httptest.NewServer(verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out, ok := edge.PrincipalFromContext(r.Context())
+		if !ok {
+			t.Error("Missing verified principal")
+			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		if *out != tenant {
-			t.Errorf("Incorrect tenant scope verifed [%s]", *out)
+		if out.TenantID != tenant {
+			t.Errorf("Incorrect tenant scope verifed [%s]", out.TenantID)
+		}
+
+		if out.IdentityID != creds.IdentityID || out.KeyID != creds.KeyID {
+			t.Errorf("Incorrect principal verifed [%v]", *out)
 		}
 
 		w.WriteHeader(http.StatusOK)
-	}))
+	})))
 	defer xs.Close()
 
 	client := &http.Client{Transport: client.OAuth2TransportFromSource(source)}
@@ -0,0 +1,177 @@
+package admin
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+type KeyStatus string
+
+const (
+	// Next keys are published for verification ahead of activation
+	Next KeyStatus = "next"
+	// Active is the single key used to sign tokens
+	Active KeyStatus = "active"
+	// Previous keys are published until every token they signed has expired
+	Previous KeyStatus = "previous"
+)
+
+// KeyRing holds the server signing keys through a rotation
+//
+//   publish:  generate a 'next' key, edge services start trusting it
+//   activate: 'next' becomes 'active', 'active' becomes 'previous'
+//   retire:   'previous' keys are removed
+//
+// Each stage must be deployed (and edge key sets refreshed) before the
+// next one is run.
+type KeyRing struct {
+	Keys []RingKey `json:"keys"`
+}
+
+type RingKey struct {
+	KeyID      string    `json:"kid"`
+	Status     KeyStatus `json:"status"`
+	PrivateKey string    `json:"private_key"` // PEM
+}
+
+// LoadKeyRing reads a JSON key ring, a single EC PRIVATE KEY PEM (as
+// created by 'server-bootstrap') is loaded as the active key.
+func LoadKeyRing(raw []byte) (*KeyRing, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("-----BEGIN")) {
+		key, err := LoadPrivateKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		kid, err := Thumbprint(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		return &KeyRing{Keys: []RingKey{{
+			KeyID:      kid,
+			Status:     Active,
+			PrivateKey: string(raw),
+		}}}, nil
+	}
+
+	var ring KeyRing
+	err := json.Unmarshal(raw, &ring)
+	if err != nil {
+		return nil, fmt.Errorf("decode key ring: %v", err)
+	}
+	return &ring, ring.validate()
+}
+
+func (x KeyRing) Render() ([]byte, error) {
+	return json.MarshalIndent(x, "", "  ")
+}
+
+// Active returns the signing key
+func (x KeyRing) Active() (*RingKey, error) {
+	for i := range x.Keys {
+		if x.Keys[i].Status == Active {
+			return &x.Keys[i], nil
+		}
+	}
+	return nil, errors.New("key ring has no active key")
+}
+
+// Publish adds a new 'next' key
+func (x *KeyRing) Publish() error {
+	for _, k := range x.Keys {
+		if k.Status == Next {
+			return fmt.Errorf("key ring already has a next key [%s]", k.KeyID)
+		}
+	}
+
+	creds, err := GenerateServerCredentials()
+	if err != nil {
+		return err
+	}
+	kid, err := Thumbprint(creds.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	x.Keys = append(x.Keys, RingKey{
+		KeyID:      kid,
+		Status:     Next,
+		PrivateKey: string(creds.RenderPrivateKey()),
+	})
+	return nil
+}
+
+// Activate signs with the 'next' key, the active key is kept as 'previous'
+func (x *KeyRing) Activate() error {
+	next := -1
+	for i, k := range x.Keys {
+		if k.Status == Next {
+			next = i
+		}
+	}
+	if next < 0 {
+		return errors.New("key ring has no next key, run publish first")
+	}
+
+	for i := range x.Keys {
+		if x.Keys[i].Status == Active {
+			x.Keys[i].Status = Previous
+		}
+	}
+	x.Keys[next].Status = Active
+	return nil
+}
+
+// Retire removes 'previous' keys
+func (x *KeyRing) Retire() error {
+	keys := make([]RingKey, 0, len(x.Keys))
+	for _, k := range x.Keys {
+		if k.Status != Previous {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == len(x.Keys) {
+		return errors.New("key ring has no previous keys")
+	}
+	x.Keys = keys
+	return nil
+}
+
+func (x KeyRing) validate() error {
+	active := 0
+	for _, k := range x.Keys {
+		switch k.Status {
+		case Active:
+			active++
+		case Next, Previous:
+		default:
+			return fmt.Errorf("key [%s] has invalid status [%s]", k.KeyID, k.Status)
+		}
+		if k.KeyID == "" {
+			return errors.New("key ring key is missing 'kid'")
+		}
+	}
+	if active != 1 {
+		return fmt.Errorf("key ring must have exactly one active key, found %d", active)
+	}
+	return nil
+}
+
+func (x RingKey) Load() (*ecdsa.PrivateKey, error) {
+	return LoadPrivateKey([]byte(x.PrivateKey))
+}
+
+// Thumbprint is the RFC 7638 'kid' of a public key
+func Thumbprint(pub crypto.PublicKey) (string, error) {
+	thumb, err := (&jose.JSONWebKey{Key: pub}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("unable to compute thumbprint: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(thumb), nil
+}
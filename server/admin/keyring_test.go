@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"testing"
+)
+
+func TestKeyRing(t *testing.T) {
+	creds, err := GenerateServerCredentials()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// 'server-bootstrap' output is a ring with one active key
+	ring, err := LoadKeyRing(creds.RenderPrivateKey())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	original, err := ring.Active()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if ring.Activate() == nil {
+		t.Fatal("expected activate without a next key to fail")
+	}
+	if ring.Retire() == nil {
+		t.Fatal("expected retire without a previous key to fail")
+	}
+
+	err = ring.Publish()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if ring.Publish() == nil {
+		t.Fatal("expected second publish to fail")
+	}
+	expectStatus(t, ring, Active, Next)
+
+	err = ring.Activate()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectStatus(t, ring, Previous, Active)
+
+	active, err := ring.Active()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if active.KeyID == original.KeyID {
+		t.Fatal("expected new active key")
+	}
+
+	// Round trip through the rendered form
+	raw, err := ring.Render()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ring, err = LoadKeyRing(raw)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = ring.Retire()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(ring.Keys) != 1 || ring.Keys[0].KeyID != active.KeyID {
+		t.Fatalf("unexpected keys after retire %v", ring.Keys)
+	}
+}
+
+func expectStatus(t *testing.T, ring *KeyRing, status ...KeyStatus) {
+	if len(ring.Keys) != len(status) {
+		t.Fatalf("expected %d keys, found %d", len(status), len(ring.Keys))
+	}
+	for i, s := range status {
+		if ring.Keys[i].Status != s {
+			t.Fatalf("key %d: expected status [%s] got [%s]", i, s, ring.Keys[i].Status)
+		}
+	}
+}
@@ -2,36 +2,49 @@ package server
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 
 	"formation.engineering/library/lib/telemetry/v1"
 	"formation.engineering/oauth2-jwt/store"
 )
 
+// AuthorizationGrant handles a token request body, any failure is
+// returned as an *Error (see AsError) carrying the OAuth 2.0 error code.
 func AuthorizationGrant(
 	b telemetry.Builder,
 	c Config,
 	x store.ReadOnlyStore,
 	requestBody string,
 ) (json.RawMessage, error) {
-	auth, err := AuthorizeBody(b, x, requestBody)
-
-	if errors.Is(err, NotAuthorized) {
-		return nil, fmt.Errorf("todo unauthorized: %v", err)
-	} else if err != nil {
-		return nil, fmt.Errorf("authorize: %v", err)
+	auth, err := AuthorizeBody(b, c, x, requestBody)
+	if err != nil {
+		return nil, logError(b, AsError(err))
 	}
 
-	res, err := Grant(b, c, auth.TenantID, auth.RequestDuration)
+	return grantResponse(b, c, auth)
+}
+
+func grantResponse(b telemetry.Builder, c Config, auth *Authorized) (json.RawMessage, error) {
+	res, err := Grant(b, c, *auth)
 	if err != nil {
-		return nil, fmt.Errorf("grant: %v", err)
+		return nil, logError(b, newError(ServerError, "", fmt.Errorf("grant: %w", err)))
 	}
 
 	payload, err := json.Marshal(*res)
 	if err != nil {
-		return nil, fmt.Errorf("marshal response: %v", err)
+		return nil, logError(b, newError(ServerError, "", fmt.Errorf("marshal response: %w", err)))
 	}
 
 	return payload, nil
 }
+
+func logError(b telemetry.Builder, err *Error) *Error {
+	b.String("oauth_error", string(err.Code))
+	if err.Description != "" {
+		b.String("oauth_error_description", err.Description)
+	}
+	if err.Reason != "" {
+		b.String("oauth_rejection", string(err.Reason))
+	}
+	return err
+}
@@ -1,11 +1,11 @@
 package server
 
 import (
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"formation.engineering/library/lib/telemetry/v1"
@@ -15,63 +15,74 @@ import (
 
 type Authorized struct {
 	TenantID        string
+	IdentityID      string
+	KeyID           string
+	Scopes          []string
 	RequestDuration *int64
+	// MaxLifetime of the granted token from the key policy, 0 is the
+	// Config default
+	MaxLifetime time.Duration
+	// PolicyScopes from the key policy, Grant drops Scopes not in it. Empty
+	// allows any.
+	PolicyScopes []string
 }
 
-var NotAuthorized = errors.New("unauthorized")
-
-func AuthorizeRequest(b telemetry.Builder, x store.ReadOnlyStore, r *http.Request) (*Authorized, error) {
+func AuthorizeRequest(b telemetry.Builder, c Config, x store.ReadOnlyStore, r *http.Request) (*Authorized, error) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read body: %s: %w", err.Error(), NotAuthorized)
+		return nil, bodyError("unable to read body", err)
 	}
-	return AuthorizeBody(b, x, string(body))
+	return AuthorizeBody(b, c, x, string(body))
 }
 
-func AuthorizeBody(b telemetry.Builder, x store.ReadOnlyStore, body string) (*Authorized, error) {
+func AuthorizeBody(b telemetry.Builder, c Config, x store.ReadOnlyStore, body string) (*Authorized, error) {
 	values, err := url.ParseQuery(body)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse body: %s: %w", err.Error(), NotAuthorized)
+		return nil, newError(InvalidRequest, "unable to parse body", err)
 	}
 	gt := values.Get("grant_type")
 	as := values.Get("assertion")
 
-	// TODO error not supported
+	if gt == "" {
+		return nil, newError(InvalidRequest, "missing 'grant_type'", nil)
+	}
+
 	if gt != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
-		return nil, fmt.Errorf("Unsupported 'grant_type' [%s]: %w", gt, NotAuthorized)
+		return nil, newError(UnsupportedGrantType, fmt.Sprintf("unsupported 'grant_type' [%s]", gt), nil)
 	}
 
 	if as == "" {
-		return nil, fmt.Errorf("Unsupported empty 'assertion': %w", NotAuthorized)
+		return nil, newError(InvalidRequest, "missing 'assertion'", nil)
 	}
 
-	res, err := Authorize(b, x, as, time.Now())
-	if err != nil {
-		return nil, fmt.Errorf("authorization failure: %v: %w", err.Error(), NotAuthorized)
-	}
-	return res, nil
+	return Authorize(b, c, x, as, time.Now())
 }
 
 // https://tools.ietf.org/html/rfc7523#section-3
-func Authorize(b telemetry.Builder, x store.ReadOnlyStore, token string, now time.Time) (*Authorized, error) {
+func Authorize(b telemetry.Builder, c Config, x store.ReadOnlyStore, token string, now time.Time) (*Authorized, error) {
 	var err error
 	parsedJWT, err := jwt.ParseSigned(token)
 	if err != nil {
-		return nil, fmt.Errorf("parsing token: %w", err)
+		return nil, newError(InvalidGrant, "malformed assertion", err)
 	}
 
-	// TODO validation
 	parsedKeyID := parsedJWT.Headers[0].KeyID
+	if parsedKeyID == "" {
+		return nil, newError(InvalidClient, "missing 'kid' header", nil)
+	}
 
 	b.String("key_id", parsedKeyID)
 
 	var keyInfo *store.KeyInfo
 	//	fmt.Printf("Using key [%s]\n", parsedKeyID)
 	keyInfo, err = x.GetKey(parsedKeyID)
+	if r, ok := x.(store.Reporter); ok {
+		r.Report(b)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("getting key: %w", err)
+		return nil, newError(ServerError, "", fmt.Errorf("getting key: %w", err))
 	} else if keyInfo == nil {
-		return nil, fmt.Errorf("keyInfo is empty: %w", NotAuthorized)
+		return nil, newError(InvalidClient, "unknown key", nil)
 	}
 
 	b.String("tenant_id", keyInfo.TenantID)
@@ -80,42 +91,142 @@ func Authorize(b telemetry.Builder, x store.ReadOnlyStore, token string, now tim
 	// Verify and decode Claims
 	var verifiedJwtClaims jwt.Claims
 	var extraClaims extraClaims
-	err = parsedJWT.Claims(keyInfo.PublicKey, &verifiedJwtClaims, &extraClaims)
+	var rawClaims map[string]interface{}
+	err = parsedJWT.Claims(keyInfo.PublicKey, &verifiedJwtClaims, &extraClaims, &rawClaims)
 	if err != nil {
-		return nil, fmt.Errorf("failed public key decode: %w", err)
+		return nil, newError(InvalidGrant, "invalid assertion signature", err)
+	}
+
+	// Checked once the assertion is verified, so the key status is only
+	// revealed to its holder
+	b.String("key_status", string(keyInfo.Status))
+	err = checkKeyStatus(keyInfo, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkRequiredClaims(c, rawClaims)
+	if err != nil {
+		return nil, err
 	}
 
 	expected := jwt.Expected{
 		Issuer:   keyInfo.IdentityID,
 		Subject:  "",
-		Audience: jwt.Audience{"formation"}, // TODO audience
+		Audience: nil, // any accepted audience, see checkAudience
 		ID:       "",
 		Time:     now,
 	}
 
-	err = verifiedJwtClaims.Validate(expected)
+	err = verifiedJwtClaims.ValidateWithLeeway(expected, c.clockSkew())
 	if err != nil {
-		return nil, fmt.Errorf("jwt claim validation failure: %w", err)
+		return nil, rejectValidation(err)
 	}
 
-	if extraClaims.RequestDuration > int64(GrantDuration.Seconds()) {
-		return nil, fmt.Errorf("specified 'request_duration' is larger then the maximum allowed: %d > %d", extraClaims.RequestDuration, int64(GrantDuration.Seconds()))
+	policy := c.policy(keyInfo)
+
+	err = checkAudience(c, policy, verifiedJwtClaims)
+	if err != nil {
+		return nil, err
 	}
 
-	if extraClaims.RequestDuration > 0 {
-		b.Int("request_duration", int(extraClaims.RequestDuration))
-		return &Authorized{
-			TenantID:        keyInfo.TenantID,
-			RequestDuration: &extraClaims.RequestDuration,
-		}, nil
+	err = checkLifetime(c, verifiedJwtClaims, now)
+	if err != nil {
+		return nil, err
+	}
+
+	maxLifetime := c.maxLifetime()
+	if policy != nil && policy.MaxLifetime > 0 {
+		maxLifetime = policy.MaxLifetime
+		b.Duration("policy_max_lifetime", maxLifetime)
+	}
+
+	if max := int64(maxLifetime.Seconds()); extraClaims.RequestDuration > max {
+		return nil, newError(InvalidGrant, fmt.Sprintf("specified 'request_duration' is larger then the maximum allowed: %d > %d", extraClaims.RequestDuration, max), nil)
 	}
 
-	return &Authorized{
+	allowed := keyInfo.Scopes
+	if policy != nil {
+		allowed = limitScopes(allowed, policy.Scopes)
+	}
+
+	scopes, err := grantScopes(extraClaims.Scope, allowed)
+	if err != nil {
+		return nil, err
+	}
+	b.String("scope", strings.Join(scopes, " "))
+
+	err = checkReplay(b, c, verifiedJwtClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	recordUsage(b, x, parsedKeyID, now)
+
+	auth := Authorized{
 		TenantID:        keyInfo.TenantID,
+		IdentityID:      keyInfo.IdentityID,
+		KeyID:           parsedKeyID,
+		Scopes:          scopes,
 		RequestDuration: nil,
-	}, nil
+	}
+
+	if policy != nil {
+		auth.MaxLifetime = policy.MaxLifetime
+		auth.PolicyScopes = policy.Scopes
+	}
+
+	if extraClaims.RequestDuration > 0 {
+		b.Int("request_duration", int(extraClaims.RequestDuration))
+		auth.RequestDuration = &extraClaims.RequestDuration
+	}
+
+	return &auth, nil
+}
+
+// recordUsage when the store tracks it, a failure is logged rather than
+// failing the grant
+func recordUsage(b telemetry.Builder, x store.ReadOnlyStore, kid store.KeyID, now time.Time) {
+	usage, ok := x.(store.UsageRecorder)
+	if !ok {
+		return
+	}
+
+	err := usage.KeyUsed(kid, now)
+	if err != nil {
+		b.String("key_usage_error", err.Error())
+	}
+}
+
+// checkReplay rejects a reused 'jti', it runs after every other check so
+// a rejected assertion can be retried. The 'jti' is kept until 'exp' plus
+// the clock skew, as long as the assertion itself is accepted.
+func checkReplay(b telemetry.Builder, c Config, claims jwt.Claims) error {
+	if c.Replay == nil {
+		return nil
+	}
+
+	if claims.ID == "" {
+		return reject(MissingClaim, "missing 'jti' claim", nil)
+	}
+	if claims.Expiry == nil {
+		return reject(MissingClaim, "missing 'exp' claim", nil)
+	}
+
+	b.String("assertion_id", claims.ID)
+
+	seen, err := c.Replay.Seen(claims.Issuer, claims.ID, claims.Expiry.Time().Add(c.clockSkew()))
+	if err != nil {
+		return newError(ServerError, "", fmt.Errorf("replay cache: %w", err))
+	}
+	if seen {
+		return reject(Replayed, "assertion 'jti' has already been used", nil)
+	}
+
+	return nil
 }
 
 type extraClaims struct {
-	RequestDuration int64 `json:"request_duration"` // seconds
+	RequestDuration int64  `json:"request_duration"` // seconds
+	Scope           string `json:"scope"`            // space delimited
 }
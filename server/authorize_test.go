@@ -2,6 +2,7 @@ package server
 
 import (
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"gopkg.in/square/go-jose.v2/jwt"
 
 	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/server/admin"
 	"formation.engineering/oauth2-jwt/server/client"
 	"formation.engineering/oauth2-jwt/store"
 	"formation.engineering/oauth2-jwt/store/memory"
@@ -25,7 +27,7 @@ func TestAuthorize(t *testing.T) {
 }
 
 func fail(t *testing.T, x store.ReadOnlyStore, token string) {
-	_, err := Authorize(telemetry.NewTestingBuilder(t), x, token, time.Now())
+	_, err := Authorize(telemetry.NewTestingBuilder(t), Config{}, x, token, time.Now())
 	if err == nil {
 		t.Fatal(err.Error())
 	}
@@ -35,19 +37,7 @@ func TestInvalidClaims(t0 *testing.T) {
 	// Setup
 	b := telemetry.NewTestingBuilder(t0)
 	s1 := memory.NewMemoryStore()
-	req := client.Request{"tenant", "name", "application", "darren"}
-	creds, _ := client.NewCredentials(b, s1, client.TestRSAGenerator{}, req)
-
-	validSigningKey := jose.SigningKey{
-		Algorithm: jose.RS256,
-		Key: &jose.JSONWebKey{
-			KeyID:     (*creds).KeyID,
-			Algorithm: "RSA",
-			Key:       (*creds).CryptoKey,
-		},
-	}
-
-	validJwtSig, _ := jose.NewSigner(validSigningKey, (&jose.SignerOptions{}).WithType("JWT"))
+	creds, validJwtSig := newTestKey(t0, s1, testRequest("tenant"))
 
 	xtime := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
 
@@ -58,8 +48,8 @@ func TestInvalidClaims(t0 *testing.T) {
 			NotBefore: jwt.NewNumericDate(xtime),
 			Audience:  jwt.Audience{"formation"},
 		}
-		token, _ := jwt.Signed(validJwtSig).Claims(cl).CompactSerialize()
-		_, err := Authorize(b, s1, token, xtime)
+		token := signTest(t, validJwtSig, cl)
+		_, err := Authorize(b, Config{}, s1, token, xtime)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -72,7 +62,7 @@ func TestInvalidClaims(t0 *testing.T) {
 			NotBefore: jwt.NewNumericDate(xtime),
 			Audience:  jwt.Audience{"formation"},
 		}
-		token, _ := jwt.Signed(validJwtSig).Claims(cl).CompactSerialize()
+		token := signTest(t, validJwtSig, cl)
 		failWith(t, b, s1, token, xtime.Add(-2*time.Minute), jwt.ErrNotValidYet)
 	})
 
@@ -83,7 +73,7 @@ func TestInvalidClaims(t0 *testing.T) {
 			NotBefore: jwt.NewNumericDate(xtime),
 			Audience:  jwt.Audience{"wrong-audience"},
 		}
-		token, _ := jwt.Signed(validJwtSig).Claims(cl).CompactSerialize()
+		token := signTest(t, validJwtSig, cl)
 		failWith(t, b, s1, token, xtime, jwt.ErrInvalidAudience)
 	})
 
@@ -94,8 +84,9 @@ func TestInvalidClaims(t0 *testing.T) {
 			Expiry:   jwt.NewNumericDate(xtime),
 			Audience: jwt.Audience{"formation"},
 		}
-		token, _ := jwt.Signed(validJwtSig).Claims(cl).CompactSerialize()
+		token := signTest(t, validJwtSig, cl)
 		failWith(t, b, s1, token, xtime.Add(2*time.Minute), jwt.ErrExpired)
+		failWith(t, b, s1, token, xtime.Add(2*time.Minute), InvalidGrant)
 	})
 
 	t0.Run("Validate iat", func(t *testing.T) {
@@ -105,7 +96,7 @@ func TestInvalidClaims(t0 *testing.T) {
 			IssuedAt: jwt.NewNumericDate(xtime),
 			Audience: jwt.Audience{"formation"},
 		}
-		token, _ := jwt.Signed(validJwtSig).Claims(cl).CompactSerialize()
+		token := signTest(t, validJwtSig, cl)
 		failWith(t, b, s1, token, xtime.Add(-2*time.Minute), jwt.ErrIssuedInTheFuture)
 	})
 
@@ -116,7 +107,7 @@ func TestInvalidClaims(t0 *testing.T) {
 			IssuedAt: jwt.NewNumericDate(xtime),
 			Audience: jwt.Audience{"formation"},
 		}
-		token, _ := jwt.Signed(validJwtSig).Claims(cl).CompactSerialize()
+		token := signTest(t, validJwtSig, cl)
 		failWith(t, b, s1, token, xtime, jwt.ErrInvalidIssuer)
 	})
 
@@ -128,17 +119,37 @@ func TestInvalidClaims(t0 *testing.T) {
 				Key:       (*creds).CryptoKey,
 			},
 		}
-		invalidJwtSig, _ := jose.NewSigner(invalidSigningKey, (&jose.SignerOptions{}).WithType("JWT"))
+		invalidJwtSig, err := jose.NewSigner(invalidSigningKey, (&jose.SignerOptions{}).WithType("JWT"))
+		if err != nil {
+			t.Fatal(err)
+		}
 		cl := jwt.Claims{
 			Issuer:   creds.IdentityID,
 			IssuedAt: jwt.NewNumericDate(xtime),
 			Audience: jwt.Audience{"formation"},
 		}
-		token, _ := jwt.Signed(invalidJwtSig).Claims(cl).CompactSerialize()
-		failWith(t, b, s1, token, xtime, NotAuthorized)
+		token := signTest(t, invalidJwtSig, cl)
+		failWith(t, b, s1, token, xtime, InvalidClient)
 	})
 }
 
+func TestAuthorizeBody(t *testing.T) {
+	b := telemetry.NewTestingBuilder(t)
+
+	check := func(body string, code ErrorCode) {
+		_, err := AuthorizeBody(b, Config{}, emptyStore, body)
+		if !errors.Is(err, code) {
+			t.Fatalf("body [%s] expected [%s] got [%v]", body, code, err)
+		}
+	}
+
+	check("%zz", InvalidRequest)
+	check("", InvalidRequest)
+	check("grant_type=password", UnsupportedGrantType)
+	check("grant_type=urn:ietf:params:oauth:grant-type:jwt-bearer", InvalidRequest)
+	check("grant_type=urn:ietf:params:oauth:grant-type:jwt-bearer&assertion=invalid", InvalidGrant)
+}
+
 func failWith(
 	t *testing.T,
 	b telemetry.Builder,
@@ -147,8 +158,430 @@ func failWith(
 	authorizeTime time.Time,
 	check error,
 ) {
-	_, err := Authorize(b, s1, token, authorizeTime)
+	_, err := Authorize(b, Config{}, s1, token, authorizeTime)
 	if !errors.Is(err, check) {
 		t.Fatal(err.Error())
 	}
 }
+
+// testRequest for a key of the tenant
+func testRequest(tenantID string) client.Request {
+	return client.Request{
+		TenantID:        tenantID,
+		TenantName:      "name",
+		ApplicationName: "application",
+		CreatedBy:       "darren",
+	}
+}
+
+// newTestKey adds a key for req to x, with a signer of its assertions
+func newTestKey(t *testing.T, x store.Store, req client.Request) (*client.Credentials, jose.Signer) {
+	t.Helper()
+	creds, err := client.NewCredentials(telemetry.NewTestingBuilder(t), x, client.TestRSAGenerator{}, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return creds, newTestSigner(t, creds)
+}
+
+func newTestSigner(t *testing.T, creds *client.Credentials) jose.Signer {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.RS256,
+		Key:       &jose.JSONWebKey{KeyID: creds.KeyID, Key: creds.CryptoKey},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// signTest serializes an assertion of the claims
+func signTest(t *testing.T, signer jose.Signer, claims ...interface{}) string {
+	t.Helper()
+	builder := jwt.Signed(signer)
+	for _, c := range claims {
+		builder = builder.Claims(c)
+	}
+	token, err := builder.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func setTestStatus(t *testing.T, x store.Store, kid store.KeyID, status store.KeyStatus) {
+	t.Helper()
+	err := x.SetKeyStatus(kid, store.StatusChange{Status: status})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthorizeScopes(t0 *testing.T) {
+	b := telemetry.NewTestingBuilder(t0)
+	s1 := memory.NewMemoryStore()
+	req := testRequest("tenant")
+	req.Scopes = []string{"read", "write"}
+	creds, signer := newTestKey(t0, s1, req)
+
+	xtime := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	authorize := func(t *testing.T, scope string) (*Authorized, error) {
+		cl := jwt.Claims{
+			Issuer:   creds.IdentityID,
+			IssuedAt: jwt.NewNumericDate(xtime),
+			Audience: jwt.Audience{"formation"},
+		}
+		token := signTest(t, signer, cl, map[string]interface{}{"scope": scope})
+		return Authorize(b, Config{}, s1, token, xtime)
+	}
+
+	check := func(t *testing.T, scope string, expected ...string) {
+		auth, err := authorize(t, scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(auth.Scopes, " ") != strings.Join(expected, " ") {
+			t.Fatalf("requested [%s] expected %v got %v", scope, expected, auth.Scopes)
+		}
+	}
+
+	t0.Run("default", func(t *testing.T) {
+		check(t, "", "read", "write")
+	})
+
+	t0.Run("subset", func(t *testing.T) {
+		check(t, "read", "read")
+		check(t, "read admin", "read")
+	})
+
+	t0.Run("invalid", func(t *testing.T) {
+		_, err := authorize(t, "admin")
+		if !errors.Is(err, InvalidScope) {
+			t.Fatalf("expected invalid_scope got [%v]", err)
+		}
+	})
+
+	t0.Run("tenant", func(t *testing.T) {
+		for _, scope := range []string{"tenant:other", "read tenant:other", "tenant:tenant"} {
+			_, err := authorize(t, scope)
+			if !errors.Is(err, InvalidScope) {
+				t.Fatalf("requested [%s] expected invalid_scope got [%v]", scope, err)
+			}
+		}
+	})
+}
+
+// tenantScopeStore adds a tenant scope to every key, as a store written
+// before tenant scopes were rejected could hold
+type tenantScopeStore struct {
+	store.Store
+}
+
+func (x tenantScopeStore) AddKey(kid store.KeyID, in store.AddKey) (*store.IdentityID, error) {
+	in.Scopes = append(in.Scopes, "tenant:other")
+	return x.Store.AddKey(kid, in)
+}
+
+func TestTenantScopeInjection(t0 *testing.T) {
+	b := telemetry.NewTestingBuilder(t0)
+
+	t0.Run("new key", func(t *testing.T) {
+		req := testRequest("tenant")
+		req.Scopes = []string{"read", "tenant:other"}
+		_, err := client.NewCredentials(b, memory.NewMemoryStore(), client.TestRSAGenerator{}, req)
+		if !errors.Is(err, client.ReservedScope) {
+			t.Fatalf("expected reserved scope got [%v]", err)
+		}
+
+		req = testRequest("tenant")
+		req.Policy = &store.KeyPolicy{Scopes: []string{"tenant:other"}}
+		_, err = client.NewCredentials(b, memory.NewMemoryStore(), client.TestRSAGenerator{}, req)
+		if !errors.Is(err, client.ReservedScope) {
+			t.Fatalf("expected reserved scope got [%v]", err)
+		}
+	})
+
+	t0.Run("stored key", func(t *testing.T) {
+		s1 := tenantScopeStore{memory.NewMemoryStore()}
+		req := testRequest("tenant")
+		req.Scopes = []string{"read"}
+		creds, signer := newTestKey(t, s1, req)
+
+		now := time.Now()
+		token := signTest(t, signer, jwt.Claims{
+			Issuer:   creds.IdentityID,
+			IssuedAt: jwt.NewNumericDate(now),
+			Audience: jwt.Audience{"formation"},
+		})
+		auth, err := Authorize(b, Config{}, s1, token, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(auth.Scopes, " ") != "read" {
+			t.Fatalf("unexpected scopes %v", auth.Scopes)
+		}
+	})
+
+	t0.Run("grant", func(t *testing.T) {
+		serverCreds, err := admin.GenerateServerCredentials()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := Config{PrivateKey: serverCreds.PrivateKey}
+
+		res, err := Grant(b, c, Authorized{TenantID: "tenant", Scopes: []string{"tenant:other", "read"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Scope != "tenant:tenant read" {
+			t.Fatalf("unexpected scope [%s]", res.Scope)
+		}
+
+		p, err := c.Verifier(nil).Verify(b, res.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.TenantID != "tenant" {
+			t.Fatalf("unexpected tenant [%s]", p.TenantID)
+		}
+	})
+}
+
+func TestAuthorizeReplay(t0 *testing.T) {
+	b := telemetry.NewTestingBuilder(t0)
+	s1 := memory.NewMemoryStore()
+	creds, signer := newTestKey(t0, s1, testRequest("tenant"))
+	c := Config{Replay: memory.NewReplayCache()}
+
+	now := time.Now()
+	assertion := func(t *testing.T, id string) string {
+		return signTest(t, signer, jwt.Claims{
+			ID:       id,
+			Issuer:   creds.IdentityID,
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(time.Minute)),
+			Audience: jwt.Audience{"formation"},
+		})
+	}
+
+	t0.Run("replay", func(t *testing.T) {
+		token := assertion(t, "1")
+		_, err := Authorize(b, c, s1, token, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Authorize(b, c, s1, token, now)
+		if !errors.Is(err, InvalidGrant) {
+			t.Fatalf("expected invalid_grant got [%v]", err)
+		}
+		_, err = Authorize(b, c, s1, assertion(t, "2"), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t0.Run("expired within skew", func(t *testing.T) {
+		// 'exp' has passed but is inside the default leeway
+		token := signTest(t, signer, jwt.Claims{
+			ID:       "3",
+			Issuer:   creds.IdentityID,
+			IssuedAt: jwt.NewNumericDate(now.Add(-time.Minute)),
+			Expiry:   jwt.NewNumericDate(now.Add(-10 * time.Second)),
+			Audience: jwt.Audience{"formation"},
+		})
+		_, err := Authorize(b, c, s1, token, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Authorize(b, c, s1, token, now)
+		if !errors.Is(err, Replayed) {
+			t.Fatalf("expected [%s] got [%v]", Replayed, err)
+		}
+	})
+
+	t0.Run("missing jti", func(t *testing.T) {
+		_, err := Authorize(b, c, s1, assertion(t, ""), now)
+		if !errors.Is(err, InvalidGrant) {
+			t.Fatalf("expected invalid_grant got [%v]", err)
+		}
+	})
+
+	t0.Run("usage", func(t *testing.T) {
+		// only the accepted assertions are counted
+		meta, err := s1.GetKeyMetadata(creds.KeyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta == nil || meta.UseCount != 3 || !meta.LastUsed.Equal(now.UTC()) {
+			t.Fatalf("expected 3 uses at [%s] got %+v", now, meta)
+		}
+	})
+}
+
+func TestAuthorizeRules(t0 *testing.T) {
+	b := telemetry.NewTestingBuilder(t0)
+	s1 := memory.NewMemoryStore()
+	creds, signer := newTestKey(t0, s1, testRequest("tenant"))
+	c := Config{
+		MaxAssertionLifetime: time.Hour,
+		ClockSkew:            5 * time.Minute,
+		RequiredClaims:       []string{"iat", "exp"},
+	}
+
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	assertion := func(t *testing.T, iat, exp *jwt.NumericDate) string {
+		return signTest(t, signer, jwt.Claims{
+			Issuer:   creds.IdentityID,
+			IssuedAt: iat,
+			Expiry:   exp,
+			Audience: jwt.Audience{"formation"},
+		})
+	}
+	at := func(d time.Duration) *jwt.NumericDate {
+		return jwt.NewNumericDate(now.Add(d))
+	}
+	check := func(t *testing.T, token string, reason Rejection) {
+		_, err := Authorize(b, c, s1, token, now)
+		if !errors.Is(err, reason) || !errors.Is(err, InvalidGrant) {
+			t.Fatalf("expected [%s] got [%v]", reason, err)
+		}
+	}
+
+	t0.Run("valid", func(t *testing.T) {
+		_, err := Authorize(b, c, s1, assertion(t, at(0), at(time.Hour)), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t0.Run("skew", func(t *testing.T) {
+		_, err := Authorize(b, c, s1, assertion(t, at(4*time.Minute), at(time.Hour)), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, assertion(t, at(6*time.Minute), at(time.Hour)), IssuedInFuture)
+	})
+
+	t0.Run("lifetime", func(t *testing.T) {
+		check(t, assertion(t, at(0), at(10*365*24*time.Hour)), LifetimeExceeded)
+
+		// the skew doesn't extend the lifetime
+		check(t, assertion(t, at(0), at(time.Hour+time.Second)), LifetimeExceeded)
+	})
+
+	t0.Run("required", func(t *testing.T) {
+		check(t, assertion(t, nil, at(time.Minute)), MissingClaim)
+		check(t, assertion(t, at(0), nil), MissingClaim)
+	})
+
+	t0.Run("expired", func(t *testing.T) {
+		check(t, assertion(t, at(-2*time.Hour), at(-time.Hour)), Expired)
+	})
+}
+
+func TestAuthorizeKeyStatus(t0 *testing.T) {
+	b := telemetry.NewTestingBuilder(t0)
+	s1 := memory.NewMemoryStore()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newKey := func(t *testing.T, expiresAt time.Time) (*client.Credentials, string) {
+		req := testRequest("tenant")
+		req.ExpiresAt = expiresAt
+		creds, signer := newTestKey(t, s1, req)
+		token := signTest(t, signer, jwt.Claims{
+			Issuer:   creds.IdentityID,
+			IssuedAt: jwt.NewNumericDate(now),
+			Audience: jwt.Audience{"formation"},
+		})
+		return creds, token
+	}
+
+	check := func(t *testing.T, token string, reason Rejection) {
+		_, err := Authorize(b, Config{}, s1, token, now)
+		if !errors.Is(err, reason) || !errors.Is(err, InvalidClient) {
+			t.Fatalf("expected [%s] got [%v]", reason, err)
+		}
+	}
+
+	t0.Run("disabled", func(t *testing.T) {
+		creds, token := newKey(t, time.Time{})
+		setTestStatus(t, s1, creds.KeyID, store.KeyDisabled)
+		check(t, token, DisabledKey)
+
+		setTestStatus(t, s1, creds.KeyID, store.KeyActive)
+		if _, err := Authorize(b, Config{}, s1, token, now); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t0.Run("revoked", func(t *testing.T) {
+		creds, token := newKey(t, time.Time{})
+		setTestStatus(t, s1, creds.KeyID, store.KeyRevoked)
+		check(t, token, RevokedKey)
+	})
+
+	t0.Run("expired", func(t *testing.T) {
+		_, token := newKey(t, now.Add(-time.Minute))
+		check(t, token, ExpiredKey)
+
+		_, token = newKey(t, now.Add(time.Minute))
+		if _, err := Authorize(b, Config{}, s1, token, now); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestAuthorizeIdentityKeys(t0 *testing.T) {
+	b := telemetry.NewTestingBuilder(t0)
+	s1 := memory.NewMemoryStore()
+	now := time.Now()
+
+	req := testRequest("tenant")
+	creds1, _ := newTestKey(t0, s1, req)
+	creds2, err := client.AddCredentials(b, s1, client.TestRSAGenerator{}, creds1.IdentityID, req)
+	if err != nil {
+		t0.Fatal(err)
+	}
+	other, _ := newTestKey(t0, s1, req)
+
+	assertion := func(t *testing.T, creds *client.Credentials, issuer string) string {
+		return signTest(t, newTestSigner(t, creds), jwt.Claims{
+			Issuer:   issuer,
+			IssuedAt: jwt.NewNumericDate(now),
+			Audience: jwt.Audience{"formation"},
+		})
+	}
+
+	t0.Run("rotation", func(t *testing.T) {
+		if creds2.IdentityID != creds1.IdentityID || creds2.KeyID == creds1.KeyID {
+			t.Fatalf("expected a new key of identity [%s] got %+v", creds1.IdentityID, creds2)
+		}
+
+		for _, creds := range []*client.Credentials{creds1, creds2} {
+			auth, err := Authorize(b, Config{}, s1, assertion(t, creds, creds1.IdentityID), now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if auth.IdentityID != creds1.IdentityID || auth.KeyID != creds.KeyID {
+				t.Fatalf("expected key [%s] of identity [%s] got %+v", creds.KeyID, creds1.IdentityID, auth)
+			}
+		}
+
+		// the old key is revoked once clients have moved
+		setTestStatus(t, s1, creds1.KeyID, store.KeyRevoked)
+		if _, err := Authorize(b, Config{}, s1, assertion(t, creds1, creds1.IdentityID), now); !errors.Is(err, RevokedKey) {
+			t.Fatalf("expected [%s] got [%v]", RevokedKey, err)
+		}
+		if _, err := Authorize(b, Config{}, s1, assertion(t, creds2, creds1.IdentityID), now); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t0.Run("other identity", func(t *testing.T) {
+		_, err := Authorize(b, Config{}, s1, assertion(t, other, creds1.IdentityID), now)
+		if !errors.Is(err, InvalidIssuer) {
+			t.Fatalf("expected [%s] got [%v]", InvalidIssuer, err)
+		}
+	})
+}
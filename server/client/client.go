@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,6 +16,13 @@ import (
 	jose "gopkg.in/square/go-jose.v2"
 )
 
+// ReservedScope is a key or policy scope with the tenant scope prefix, the
+// server grants the tenant scope itself
+var ReservedScope = errors.New("reserved scope")
+
+// tenantScopePrefix is server.TenantScopePrefix, which imports this package
+const tenantScopePrefix = "tenant:"
+
 type Credentials struct {
 	KeyID      string
 	IdentityID string
@@ -32,6 +40,10 @@ type Request struct {
 	TenantName      string
 	ApplicationName string
 	CreatedBy       string
+	Scopes          []string
+	Policy          *store.KeyPolicy
+	// ExpiresAt the key is no longer accepted, zero never expires
+	ExpiresAt time.Time
 }
 
 // Generate a long lived set of Credentials (API Key)
@@ -40,10 +52,57 @@ func NewCredentials(
 	keyStore store.Store,
 	gen GenerateKey,
 	req Request,
+) (*Credentials, error) {
+	return newCredentials(b, gen, req, keyStore.AddKey)
+}
+
+// AddCredentials generates a new key for an existing identity, the client
+// keeps its 'iss' so the old key can be revoked once replaced. The tenant
+// and application of req are ignored, they are those of the identity.
+func AddCredentials(
+	b telemetry.Builder,
+	keyStore store.Store,
+	gen GenerateKey,
+	identityID store.IdentityID,
+	req Request,
+) (*Credentials, error) {
+	return newCredentials(b, gen, req, func(kid store.KeyID, info store.AddKey) (*store.IdentityID, error) {
+		err := keyStore.AddIdentityKey(identityID, kid, info)
+		if err != nil {
+			return nil, err
+		}
+		return &identityID, nil
+	})
+}
+
+// checkScopes rejects tenant scopes, a key allowed 'tenant:other' could
+// otherwise be granted another tenant
+func checkScopes(req Request) error {
+	scopes := req.Scopes
+	if req.Policy != nil {
+		scopes = append(append([]string(nil), scopes...), req.Policy.Scopes...)
+	}
+	for _, s := range scopes {
+		if strings.HasPrefix(s, tenantScopePrefix) {
+			return fmt.Errorf("scope [%s]: %w", s, ReservedScope)
+		}
+	}
+	return nil
+}
+
+func newCredentials(
+	b telemetry.Builder,
+	gen GenerateKey,
+	req Request,
+	addKey func(store.KeyID, store.AddKey) (*store.IdentityID, error),
 ) (*Credentials, error) {
 	generateTimer := time.Now()
 
-	var err error
+	err := checkScopes(req)
+	if err != nil {
+		return nil, err
+	}
+
 	var privKey crypto.PrivateKey
 
 	var creds []byte
@@ -83,8 +142,11 @@ func NewCredentials(
 		TenantName:      req.TenantName,
 		ApplicationName: req.ApplicationName,
 		CreatedBy:       req.CreatedBy,
+		Scopes:          req.Scopes,
+		Policy:          req.Policy,
+		ExpiresAt:       req.ExpiresAt,
 	}
-	identityID, err := keyStore.AddKey(kid, keyInfo)
+	identityID, err := addKey(kid, keyInfo)
 	if err != nil {
 		return nil, errors.WithMessage(err, "store add key")
 	}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/store"
+)
+
+// ClientAssertionType authenticates a client with a signed assertion
+// https://tools.ietf.org/html/rfc7523#section-2.2
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// AuthenticateClient checks the 'client_assertion' of a request to the
+// revocation or introspection endpoints. The assertion is the same as a
+// token request assertion, any failure is an 'invalid_client'.
+func AuthenticateClient(b telemetry.Builder, c Config, x store.ReadOnlyStore, values url.Values) (*Authorized, error) {
+	if values.Get("client_assertion_type") != ClientAssertionType {
+		return nil, newError(InvalidClient, "missing or unsupported 'client_assertion_type'", nil)
+	}
+
+	assertion := values.Get("client_assertion")
+	if assertion == "" {
+		return nil, newError(InvalidClient, "missing 'client_assertion'", nil)
+	}
+
+	auth, err := Authorize(b, c, x, assertion, time.Now())
+	if errors.Is(err, ServerError) {
+		return nil, err
+	} else if err != nil {
+		e := AsError(err)
+		return nil, &Error{Code: InvalidClient, Description: e.Description, Reason: e.Reason, Err: e.Err}
+	}
+
+	return auth, nil
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"time"
+
+	"formation.engineering/oauth2-jwt/edge"
+	"formation.engineering/oauth2-jwt/store"
+)
+
+func (x Config) issuer() string {
+	if x.Issuer != "" {
+		return x.Issuer
+	}
+	return DefaultIssuer
+}
+
+func (x Config) audience() string {
+	if x.Audience != "" {
+		return x.Audience
+	}
+	return DefaultAudience
+}
+
+func (x Config) assertionAudiences() []string {
+	if len(x.AssertionAudiences) > 0 {
+		return x.AssertionAudiences
+	}
+	return []string{DefaultAudience}
+}
+
+func (x Config) maxLifetime() time.Duration {
+	if x.MaxLifetime > 0 {
+		return x.MaxLifetime
+	}
+	return GrantDuration
+}
+
+// defaultLifetime is capped by maxLifetime
+func (x Config) defaultLifetime() time.Duration {
+	lifetime := GrantDuration
+	if x.DefaultLifetime > 0 {
+		lifetime = x.DefaultLifetime
+	}
+	if max := x.maxLifetime(); lifetime > max {
+		return max
+	}
+	return lifetime
+}
+
+// policy of the key, or else its tenant
+func (x Config) policy(key *store.KeyInfo) *store.KeyPolicy {
+	if key.Policy != nil {
+		return key.Policy
+	}
+	if p, ok := x.TenantPolicies[key.TenantID]; ok {
+		return &p
+	}
+	return nil
+}
+
+// Verifier checks tokens granted with this config, as an edge service
+// configured with the same issuer and audience would
+func (x Config) Verifier(deny edge.DenyList) edge.Verifier {
+	return edge.Verifier{
+		Keys:     x,
+		DenyList: deny,
+		Issuer:   x.issuer(),
+		Audience: x.audience(),
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/edge"
+	"formation.engineering/oauth2-jwt/server/admin"
+	"formation.engineering/oauth2-jwt/store"
+	"formation.engineering/oauth2-jwt/store/memory"
+)
+
+func TestConfigAudience(t0 *testing.T) {
+	b := telemetry.NewTestingBuilder(t0)
+	s1 := memory.NewMemoryStore()
+	creds, signer := newTestKey(t0, s1, testRequest("tenant"))
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t0.Fatal(err)
+	}
+
+	c := Config{
+		PrivateKey:         serverCreds.PrivateKey,
+		Issuer:             "https://staging.example.com",
+		Audience:           "api",
+		AssertionAudiences: []string{"https://staging.example.com/token", "staging"},
+		DefaultLifetime:    10 * time.Minute,
+		MaxLifetime:        30 * time.Minute,
+	}
+
+	now := time.Now()
+	assertion := func(t *testing.T, aud string, duration int64) string {
+		return signTest(t, signer, jwt.Claims{
+			Issuer:   creds.IdentityID,
+			IssuedAt: jwt.NewNumericDate(now),
+			Audience: jwt.Audience{aud},
+		}, map[string]interface{}{"request_duration": duration})
+	}
+
+	t0.Run("assertion audience", func(t *testing.T) {
+		for _, aud := range c.AssertionAudiences {
+			if _, err := Authorize(b, c, s1, assertion(t, aud, 0), now); err != nil {
+				t.Fatalf("audience [%s]: %v", aud, err)
+			}
+		}
+		_, err := Authorize(b, c, s1, assertion(t, DefaultAudience, 0), now)
+		if !errors.Is(err, InvalidAudience) {
+			t.Fatalf("expected invalid audience got [%v]", err)
+		}
+	})
+
+	t0.Run("max lifetime", func(t *testing.T) {
+		_, err := Authorize(b, c, s1, assertion(t, "staging", 1800), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Authorize(b, c, s1, assertion(t, "staging", 3600), now)
+		if !errors.Is(err, InvalidGrant) {
+			t.Fatalf("expected invalid grant got [%v]", err)
+		}
+	})
+
+	t0.Run("grant", func(t *testing.T) {
+		res, err := Grant(b, c, Authorized{TenantID: "tenant"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.ExpiresIn != 600 {
+			t.Fatalf("unexpected expires_in [%d]", res.ExpiresIn)
+		}
+
+		_, err = c.Verifier(nil).Verify(b, res.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a verifier expecting another issuer rejects the token
+		_, err = edge.Verifier{Keys: c}.Verify(b, res.Token)
+		if err == nil {
+			t.Fatal("expected default verifier to reject token")
+		}
+	})
+}
+
+func TestKeyPolicy(t0 *testing.T) {
+	b := telemetry.NewTestingBuilder(t0)
+	s1 := memory.NewMemoryStore()
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t0.Fatal(err)
+	}
+
+	c := Config{
+		PrivateKey:         serverCreds.PrivateKey,
+		AssertionAudiences: []string{"formation", "partner"},
+		TenantPolicies: map[string]store.KeyPolicy{
+			"untrusted": {MaxLifetime: 5 * time.Minute},
+			"readonly":  {Scopes: []string{"read"}},
+		},
+	}
+
+	newKey := func(t *testing.T, tenant string, policy *store.KeyPolicy, scopes ...string) func(aud string, duration int64) (*Authorized, error) {
+		req := testRequest(tenant)
+		req.Policy = policy
+		req.Scopes = scopes
+		creds, signer := newTestKey(t, s1, req)
+
+		return func(aud string, duration int64) (*Authorized, error) {
+			now := time.Now()
+			token := signTest(t, signer, jwt.Claims{
+				Issuer:   creds.IdentityID,
+				IssuedAt: jwt.NewNumericDate(now),
+				Audience: jwt.Audience{aud},
+			}, map[string]interface{}{"request_duration": duration})
+			return Authorize(b, c, s1, token, now)
+		}
+	}
+
+	expiresIn := func(t *testing.T) func(*Authorized, error) int64 {
+		return func(auth *Authorized, err error) int64 {
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := Grant(b, c, *auth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return res.ExpiresIn
+		}
+	}
+
+	t0.Run("partner", func(t *testing.T) {
+		authorize := newKey(t, "tenant", &store.KeyPolicy{MaxLifetime: 5 * time.Minute, Audiences: []string{"partner"}})
+
+		_, err := authorize("formation", 0)
+		if !errors.Is(err, InvalidAudience) {
+			t.Fatalf("expected invalid audience got [%v]", err)
+		}
+		_, err = authorize("partner", 600)
+		if !errors.Is(err, InvalidGrant) {
+			t.Fatalf("expected invalid grant got [%v]", err)
+		}
+		if got := expiresIn(t)(authorize("partner", 0)); got != 300 {
+			t.Fatalf("unexpected expires_in [%d]", got)
+		}
+	})
+
+	t0.Run("batch", func(t *testing.T) {
+		authorize := newKey(t, "tenant", &store.KeyPolicy{MaxLifetime: 12 * time.Hour})
+
+		if got := expiresIn(t)(authorize("formation", 43200)); got != 43200 {
+			t.Fatalf("unexpected expires_in [%d]", got)
+		}
+		if got := expiresIn(t)(authorize("formation", 0)); got != 3600 {
+			t.Fatalf("unexpected expires_in [%d]", got)
+		}
+	})
+
+	t0.Run("tenant", func(t *testing.T) {
+		authorize := newKey(t, "untrusted", nil)
+
+		if got := expiresIn(t)(authorize("formation", 0)); got != 300 {
+			t.Fatalf("unexpected expires_in [%d]", got)
+		}
+	})
+	t0.Run("scopes", func(t *testing.T) {
+		authorize := newKey(t, "readonly", nil, "read", "write")
+
+		auth, err := authorize("formation", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(auth.Scopes) != 1 || auth.Scopes[0] != "read" {
+			t.Fatalf("unexpected scopes %v", auth.Scopes)
+		}
+
+		// scopes outside the policy are dropped however they were authorized
+		auth.Scopes = []string{"read", "write"}
+		res, err := Grant(b, c, *auth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Scope != "tenant:readonly read" {
+			t.Fatalf("unexpected scope [%s]", res.Scope)
+		}
+	})
+}
@@ -1,7 +1,16 @@
 package server
 
-import "time"
+import (
+	"time"
+
+	"formation.engineering/oauth2-jwt/edge"
+)
 
 const (
 	GrantDuration = 1 * time.Hour
+
+	// DefaultIssuer and DefaultAudience of granted tokens, also the
+	// default accepted assertion audience
+	DefaultIssuer   = edge.DefaultIssuer
+	DefaultAudience = edge.DefaultAudience
 )
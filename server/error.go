@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrorCode is an OAuth 2.0 error code
+// https://tools.ietf.org/html/rfc6749#section-5.2
+type ErrorCode string
+
+const (
+	InvalidRequest       ErrorCode = "invalid_request"
+	InvalidClient        ErrorCode = "invalid_client"
+	UnauthorizedClient   ErrorCode = "unauthorized_client"
+	InvalidGrant         ErrorCode = "invalid_grant"
+	UnsupportedGrantType ErrorCode = "unsupported_grant_type"
+	InvalidScope         ErrorCode = "invalid_scope"
+	ServerError          ErrorCode = "server_error"
+)
+
+// ErrorCode is an error so callers can match with errors.Is(err, InvalidGrant)
+func (x ErrorCode) Error() string {
+	return string(x)
+}
+
+func (x ErrorCode) StatusCode() int {
+	switch x {
+	case InvalidClient:
+		return http.StatusUnauthorized
+	case ServerError:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// Error is a typed OAuth 2.0 error response, the description is
+// returned to the client and the wrapped error is kept for logging.
+type Error struct {
+	Code        ErrorCode
+	Description string
+	// Reason an assertion was rejected, if any
+	Reason Rejection
+	Err    error
+}
+
+type ErrorResponse struct {
+	Error            ErrorCode `json:"error"`
+	ErrorDescription string    `json:"error_description,omitempty"`
+}
+
+func newError(code ErrorCode, description string, err error) *Error {
+	return &Error{
+		Code:        code,
+		Description: description,
+		Err:         err,
+	}
+}
+
+func (x *Error) Error() string {
+	msg := string(x.Code)
+	if x.Description != "" {
+		msg = fmt.Sprintf("%s: %s", msg, x.Description)
+	}
+	if x.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, x.Err)
+	}
+	return msg
+}
+
+func (x *Error) Unwrap() error {
+	return x.Err
+}
+
+// Is matches the code, or the rejection reason i.e.
+// errors.Is(err, LifetimeExceeded)
+func (x *Error) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrorCode:
+		return t == x.Code
+	case Rejection:
+		return t != "" && t == x.Reason
+	default:
+		return false
+	}
+}
+
+// StatusCode of the code, or 413 for a body over the handler
+// MaxRequestSize
+func (x *Error) StatusCode() int {
+	if errors.Is(x.Err, RequestTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return x.Code.StatusCode()
+}
+
+func (x *Error) Response() ErrorResponse {
+	return ErrorResponse{
+		Error:            x.Code,
+		ErrorDescription: x.Description,
+	}
+}
+
+// Body is the JSON encoded error response
+// https://tools.ietf.org/html/rfc6749#section-5.2
+func (x *Error) Body() json.RawMessage {
+	payload, err := json.Marshal(x.Response())
+	if err != nil {
+		return json.RawMessage(fmt.Sprintf(`{"error":"%s"}`, ServerError))
+	}
+	return payload
+}
+
+// AsError returns the typed error in the chain, anything untyped is
+// treated as a 'server_error'.
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return newError(ServerError, "", err)
+}
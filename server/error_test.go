@@ -0,0 +1,39 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("cause")
+	err := fmt.Errorf("wrapped: %w", newError(InvalidClient, "unknown key", cause))
+
+	if !errors.Is(err, InvalidClient) {
+		t.Fatal("expected errors.Is match on code")
+	}
+	if errors.Is(err, InvalidGrant) {
+		t.Fatal("unexpected errors.Is match on code")
+	}
+	if !errors.Is(err, cause) {
+		t.Fatal("expected errors.Is match on cause")
+	}
+
+	e := AsError(err)
+	if e.StatusCode() != http.StatusUnauthorized {
+		t.Fatalf("unexpected status code [%d]", e.StatusCode())
+	}
+	if got, want := string(e.Body()), `{"error":"invalid_client","error_description":"unknown key"}`; got != want {
+		t.Fatalf("body = %s; want %s", got, want)
+	}
+
+	unknown := AsError(cause)
+	if unknown.StatusCode() != http.StatusInternalServerError {
+		t.Fatalf("unexpected status code [%d]", unknown.StatusCode())
+	}
+	if got, want := string(unknown.Body()), `{"error":"server_error"}`; got != want {
+		t.Fatalf("body = %s; want %s", got, want)
+	}
+}
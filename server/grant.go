@@ -2,10 +2,13 @@ package server
 
 import (
 	"crypto"
-	"fmt"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
 	"time"
 
 	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/store"
 	"github.com/pkg/errors"
 	jose "gopkg.in/square/go-jose.v2"
 	jwt "gopkg.in/square/go-jose.v2/jwt"
@@ -13,6 +16,49 @@ import (
 
 type Config struct {
 	PrivateKey crypto.PrivateKey
+	// KeyID is published as 'kid', defaults to the key thumbprint
+	KeyID string
+	// VerificationKeys are published but never used to sign, i.e. the
+	// next and previous keys of a rotation (see admin.KeyRing)
+	VerificationKeys []VerificationKey
+	// Replay remembers assertion 'jti's until they expire, when set every
+	// assertion must carry a unique 'jti' and an 'exp'
+	Replay store.ReplayCache
+
+	// MaxAssertionLifetime caps 'exp' - 'iat' of an assertion (or 'exp' -
+	// now without an 'iat'), 0 is unlimited. It is exact, ClockSkew does
+	// not extend it.
+	MaxAssertionLifetime time.Duration
+	// ClockSkew is the one tolerance for the assertion times: an 'iat' or
+	// 'nbf' in the future and an 'exp' in the past, and so how long a
+	// 'jti' is kept past 'exp'. Defaults to jwt.DefaultLeeway.
+	ClockSkew time.Duration
+	// RequiredClaims an assertion must carry, i.e. "iat", "exp", "jti"
+	RequiredClaims []string
+
+	// Issuer ('iss') and Audience ('aud') of granted tokens, default to
+	// DefaultIssuer and DefaultAudience. Edge services must expect the
+	// same, see Verifier.
+	Issuer   string
+	Audience string
+	// AssertionAudiences accepted in an assertion 'aud', any one must
+	// match. Include the token endpoint URL, defaults to DefaultAudience
+	// https://tools.ietf.org/html/rfc7523#section-3
+	AssertionAudiences []string
+	// DefaultLifetime of granted tokens and the MaxLifetime an assertion
+	// 'request_duration' may ask for, both default to GrantDuration
+	DefaultLifetime time.Duration
+	MaxLifetime     time.Duration
+	// TenantPolicies apply to keys of the tenant without a KeyInfo.Policy
+	TenantPolicies map[string]store.KeyPolicy
+
+	// keys computed by Prepare
+	keys *preparedKeys
+}
+
+type VerificationKey struct {
+	KeyID     string
+	PublicKey crypto.PublicKey
 }
 
 type TenantID = string
@@ -23,35 +69,57 @@ type BearerResponse struct {
 	Token     string `json:"access_token"`
 	TokenType string `json:"token_type"`
 	ExpiresIn int64  `json:"expires_in"`
+	Scope     string `json:"scope,omitempty"`
 }
 
-func Grant(b telemetry.Builder, x Config, tenant TenantID, requestDuration *int64) (*BearerResponse, error) {
+// PrivateClaims of an issued token
+type PrivateClaims struct {
+	Scope []string `json:"scope,omitempty"`
+	// KeyID of the API key that requested the token, 'sub' is its identity
+	KeyID string `json:"key_id,omitempty"`
+}
+
+func Grant(b telemetry.Builder, x Config, auth Authorized) (*BearerResponse, error) {
+	key, err := x.SigningKey()
+	if err != nil {
+		return nil, errors.WithMessage(err, "server signing key")
+	}
+
 	signer, err :=
-		jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: x.PrivateKey}, (&jose.SignerOptions{}))
+		jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: *key}, (&jose.SignerOptions{}).WithType("JWT"))
 	if err != nil {
 		return nil, errors.WithMessage(err, "creating server signer")
 	}
 
-	grantDuration := GrantDuration
+	grantDuration := x.defaultLifetime()
 
-	if requestDuration != nil {
-		grantDuration = time.Duration(*requestDuration) * time.Second
+	if auth.RequestDuration != nil {
+		grantDuration = time.Duration(*auth.RequestDuration) * time.Second
+	}
+
+	if auth.MaxLifetime > 0 && grantDuration > auth.MaxLifetime {
+		grantDuration = auth.MaxLifetime
+	}
+
+	tokenID, err := newTokenID()
+	if err != nil {
+		return nil, errors.WithMessage(err, "token id")
 	}
 
 	now := time.Now()
 	registeredClaims := jwt.Claims{
-		Issuer:    "formation",
-		Subject:   "",
-		Audience:  jwt.Audience{"formation"},
+		Issuer:    x.issuer(),
+		Subject:   auth.IdentityID,
+		Audience:  jwt.Audience{x.audience()},
 		NotBefore: jwt.NewNumericDate(time.Time{}),
 		IssuedAt:  jwt.NewNumericDate(now),
 		Expiry:    jwt.NewNumericDate(now.Add(grantDuration)),
+		ID:        tokenID,
 	}
-	scope := fmt.Sprintf("tenant:%s", tenant)
-	privateClaims := struct {
-		Scope []string `json:"scope,omitempty"`
-	}{
-		Scope: []string{scope},
+	scope := append([]string{TenantScope(auth.TenantID)}, withoutTenantScopes(limitScopes(auth.Scopes, auth.PolicyScopes))...)
+	privateClaims := PrivateClaims{
+		Scope: scope,
+		KeyID: auth.KeyID,
 	}
 
 	clientShortJWT, err := jwt.Signed(signer).Claims(registeredClaims).Claims(privateClaims).CompactSerialize()
@@ -59,14 +127,27 @@ func Grant(b telemetry.Builder, x Config, tenant TenantID, requestDuration *int6
 		return nil, errors.WithMessage(err, "signing token")
 	}
 
+	b.String("server_key_id", key.KeyID)
+	b.String("token_id", tokenID)
 	b.Float("expires_in", grantDuration.Seconds())
 
 	res := BearerResponse{
 		Token:     clientShortJWT,
 		TokenType: "bearer",
 		ExpiresIn: int64(grantDuration.Seconds()),
+		Scope:     strings.Join(scope, " "),
 	}
 
 	return &res, nil
 
 }
+
+// newTokenID is a random 'jti'
+func newTokenID() (string, error) {
+	raw := make([]byte, 16)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
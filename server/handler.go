@@ -0,0 +1,136 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/store"
+)
+
+const (
+	TokenPath = "/token"
+
+	// MaxRequestSize caps the token request body, an assertion is a
+	// few KB at most.
+	MaxRequestSize = 64 * 1024
+)
+
+// RequestTooLarge is wrapped by the error reading a body over the handler
+// MaxRequestSize, it is answered with 413
+var RequestTooLarge = errors.New("request body too large")
+
+// NewBuilder creates the telemetry builder for a single request, it is
+// pushed once the response is written.
+type NewBuilder = func() telemetry.Builder
+
+// TokenHandler serves the token endpoint
+// https://tools.ietf.org/html/rfc6749#section-3.2
+type TokenHandler struct {
+	NewBuilder     NewBuilder
+	Config         Config
+	Store          store.ReadOnlyStore
+	MaxRequestSize int64
+}
+
+func NewTokenHandler(nb NewBuilder, c Config, x store.ReadOnlyStore) *TokenHandler {
+	return &TokenHandler{
+		NewBuilder:     nb,
+		Config:         c,
+		Store:          x,
+		MaxRequestSize: MaxRequestSize,
+	}
+}
+
+// NewServeMux routes the authorization server endpoints
+func NewServeMux(nb NewBuilder, c Config, x store.ReadOnlyStore) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(TokenPath, NewTokenHandler(nb, c, x))
+	mux.Handle(JWKSPath, NewJWKSHandler(nb, c))
+	return mux
+}
+
+func (x *TokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := x.NewBuilder()
+	defer b.Push()
+
+	if !formPost(b, w, r, x.MaxRequestSize) {
+		return
+	}
+
+	auth, err := AuthorizeRequest(b, x.Config, x.Store, r)
+	if err != nil {
+		writeError(w, logError(b, AsError(err)))
+		return
+	}
+
+	res, err := grantResponse(b, x.Config, auth)
+	if err != nil {
+		writeError(w, AsError(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// formPost checks r is a form encoded POST and limits the body size,
+// on failure the error response is written and false returned.
+func formPost(b telemetry.Builder, w http.ResponseWriter, r *http.Request, maxSize int64) bool {
+	b.String("method", r.Method)
+	b.String("content_type", r.Header.Get("Content-Type"))
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, logError(b, newError(InvalidRequest, "method must be POST", nil)).Body())
+		return false
+	}
+
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mt != "application/x-www-form-urlencoded" {
+		writeError(w, logError(b, newError(InvalidRequest, "content type must be application/x-www-form-urlencoded", err)))
+		return false
+	}
+
+	r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, maxSize), remaining: maxSize}
+	return true
+}
+
+// limitedBody marks the http.MaxBytesReader error with RequestTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (x *limitedBody) Read(p []byte) (int, error) {
+	n, err := x.ReadCloser.Read(p)
+	x.remaining -= int64(n)
+	if err != nil && err != io.EOF && x.remaining <= 0 {
+		return n, fmt.Errorf("%w: %v", RequestTooLarge, err)
+	}
+	return n, err
+}
+
+// bodyError of a body that couldn't be read or parsed
+func bodyError(description string, err error) *Error {
+	if errors.Is(err, RequestTooLarge) {
+		description = "request body is too large"
+	}
+	return newError(InvalidRequest, description, err)
+}
+
+func writeError(w http.ResponseWriter, err *Error) {
+	writeJSON(w, err.StatusCode(), err.Body())
+}
+
+// Token responses must not be cached
+// https://tools.ietf.org/html/rfc6749#section-5.1
+func writeJSON(w http.ResponseWriter, code int, body []byte) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/server/admin"
+	"formation.engineering/oauth2-jwt/store/memory"
+)
+
+func TestTokenHandler(t0 *testing.T) {
+	nb := func() telemetry.Builder { return telemetry.NewTestingBuilder(t0) }
+	s1 := memory.NewMemoryStore()
+	creds, signer := newTestKey(t0, s1, testRequest("tenant"))
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t0.Fatal(err)
+	}
+
+	ts := httptest.NewServer(NewServeMux(nb, Config{PrivateKey: serverCreds.PrivateKey}, s1))
+	defer ts.Close()
+
+	now := time.Now()
+	assertion := signTest(t0, signer, jwt.Claims{
+		Issuer:   creds.IdentityID,
+		Audience: jwt.Audience{"formation"},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(time.Minute)),
+	})
+
+	form := func(assertion string) string {
+		return url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}.Encode()
+	}
+
+	post := func(t *testing.T, contentType, body string) (*http.Response, []byte) {
+		res, err := http.Post(ts.URL+TokenPath, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		payload, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.Header.Get("Cache-Control"); got != "no-store" {
+			t.Errorf("Cache-Control = %q; want no-store", got)
+		}
+		return res, payload
+	}
+
+	t0.Run("success", func(t *testing.T) {
+		res, body := post(t, "application/x-www-form-urlencoded", form(assertion))
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status [%d] %s", res.StatusCode, body)
+		}
+		var out BearerResponse
+		if err := json.Unmarshal(body, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Token == "" || out.TokenType != "bearer" {
+			t.Fatalf("unexpected response %s", body)
+		}
+	})
+
+	t0.Run("method", func(t *testing.T) {
+		res, err := http.Get(ts.URL + TokenPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusMethodNotAllowed {
+			t.Fatalf("unexpected status [%d]", res.StatusCode)
+		}
+	})
+
+	t0.Run("content type", func(t *testing.T) {
+		res, body := post(t, "application/json", form(assertion))
+		if res.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), `"invalid_request"`) {
+			t.Fatalf("unexpected response [%d] %s", res.StatusCode, body)
+		}
+	})
+
+	t0.Run("body size", func(t *testing.T) {
+		res, body := post(t, "application/x-www-form-urlencoded", form(strings.Repeat("a", MaxRequestSize)))
+		if res.StatusCode != http.StatusRequestEntityTooLarge || !strings.Contains(string(body), `"invalid_request"`) {
+			t.Fatalf("unexpected response [%d] %s", res.StatusCode, body)
+		}
+	})
+
+	t0.Run("invalid grant", func(t *testing.T) {
+		res, body := post(t, "application/x-www-form-urlencoded", form("invalid"))
+		if res.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), `"invalid_grant"`) {
+			t.Fatalf("unexpected response [%d] %s", res.StatusCode, body)
+		}
+	})
+}
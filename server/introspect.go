@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/edge"
+	"formation.engineering/oauth2-jwt/store"
+)
+
+const (
+	IntrospectionPath = "/introspect"
+
+	// IntrospectScope lets a client introspect tokens of any tenant,
+	// without it only tokens of the client tenant are reported active.
+	IntrospectScope = "introspect"
+)
+
+// IntrospectionResponse describes a token, an inactive token carries no
+// other members
+// https://tools.ietf.org/html/rfc7662#section-2.2
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TenantID  string `json:"tenant_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Expiry    int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	TokenID   string `json:"jti,omitempty"`
+}
+
+// IntrospectionHandler serves the token introspection endpoint for
+// callers unable to verify tokens locally
+// https://tools.ietf.org/html/rfc7662
+type IntrospectionHandler struct {
+	NewBuilder NewBuilder
+	Config     Config
+	Store      store.ReadOnlyStore
+	// Revocations of tokens, optional. The store /revoke writes to, so a
+	// revoked token is inactive at once.
+	Revocations    store.RevocationStore
+	MaxRequestSize int64
+}
+
+func NewIntrospectionHandler(nb NewBuilder, c Config, x store.ReadOnlyStore, r store.RevocationStore) *IntrospectionHandler {
+	return &IntrospectionHandler{
+		NewBuilder:     nb,
+		Config:         c,
+		Store:          x,
+		Revocations:    r,
+		MaxRequestSize: MaxRequestSize,
+	}
+}
+
+// HandleIntrospection adds the introspection endpoint to mux
+func HandleIntrospection(mux *http.ServeMux, nb NewBuilder, c Config, x store.ReadOnlyStore, r store.RevocationStore) {
+	mux.Handle(IntrospectionPath, NewIntrospectionHandler(nb, c, x, r))
+}
+
+func (x *IntrospectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := x.NewBuilder()
+	defer b.Push()
+
+	if !formPost(b, w, r, x.MaxRequestSize) {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, logError(b, bodyError("unable to parse body", err)))
+		return
+	}
+
+	client, err := AuthenticateClient(b, x.Config, x.Store, r.PostForm)
+	if err != nil {
+		writeError(w, logError(b, AsError(err)))
+		return
+	}
+
+	res, err := Introspect(b, x.Config, x.Revocations, *client, r.PostForm.Get("token"))
+	if err != nil {
+		writeError(w, logError(b, AsError(err)))
+		return
+	}
+
+	payload, err := json.Marshal(res)
+	if err != nil {
+		writeError(w, logError(b, newError(ServerError, "", fmt.Errorf("marshal response: %w", err))))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payload)
+}
+
+// Introspect verifies token with the same checks as edge.Verifier, any
+// failure is reported as an inactive token. Revocations are read from r
+// rather than a polled deny list.
+func Introspect(b telemetry.Builder, c Config, r store.RevocationStore, client Authorized, token string) (*IntrospectionResponse, error) {
+	if token == "" {
+		return nil, newError(InvalidRequest, "missing 'token'", nil)
+	}
+
+	p, err := c.Verifier(nil).Verify(b, token)
+	if err != nil {
+		b.String("introspect_inactive", err.Error())
+		return &IntrospectionResponse{Active: false}, nil
+	}
+
+	if r != nil {
+		revoked, err := r.Revoked(p.TokenID, time.Now())
+		if err != nil {
+			return nil, newError(ServerError, "", fmt.Errorf("revoked: %w", err))
+		}
+		if revoked {
+			b.String("introspect_inactive", "token is revoked")
+			return &IntrospectionResponse{Active: false}, nil
+		}
+	}
+
+	if p.TenantID != client.TenantID && !edge.Scopes(client.Scopes).Has(IntrospectScope) {
+		b.String("introspect_inactive", "token was not issued to the client tenant")
+		return &IntrospectionResponse{Active: false}, nil
+	}
+
+	b.Bool("active", true)
+
+	return &IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(p.Scopes, " "),
+		ClientID:  p.KeyID,
+		Subject:   p.IdentityID,
+		TenantID:  p.TenantID,
+		TokenType: "bearer",
+		Expiry:    p.Expiry.Unix(),
+		IssuedAt:  p.IssuedAt.Unix(),
+		TokenID:   p.TokenID,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/server/admin"
+	"formation.engineering/oauth2-jwt/store/memory"
+)
+
+func TestIntrospectionHandler(t0 *testing.T) {
+	nb := func() telemetry.Builder { return telemetry.NewTestingBuilder(t0) }
+	s1 := memory.NewMemoryStore()
+	creds, _ := newTestKey(t0, s1, testRequest("tenant"))
+	gatewayReq := testRequest("gateway")
+	gatewayReq.ApplicationName = "gateway"
+	gatewayReq.Scopes = []string{IntrospectScope}
+	gateway, _ := newTestKey(t0, s1, gatewayReq)
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t0.Fatal(err)
+	}
+	c := Config{PrivateKey: serverCreds.PrivateKey}
+	revocations := memory.NewRevocationStore()
+
+	mux := http.NewServeMux()
+	HandleRevocation(mux, nb, c, s1, revocations)
+	HandleIntrospection(mux, nb, c, s1, revocations)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	introspect := func(t *testing.T, assertion, token string) (int, IntrospectionResponse) {
+		form := url.Values{
+			"client_assertion_type": {ClientAssertionType},
+			"client_assertion":      {assertion},
+			"token":                 {token},
+		}.Encode()
+		res, err := http.Post(ts.URL+IntrospectionPath, "application/x-www-form-urlencoded", strings.NewReader(form))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var out IntrospectionResponse
+		if res.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res.StatusCode, out
+	}
+
+	grant, err := Grant(nb(), c, Authorized{TenantID: "tenant", IdentityID: "1", KeyID: "key", Scopes: []string{"read"}})
+	if err != nil {
+		t0.Fatal(err)
+	}
+
+	t0.Run("active", func(t *testing.T) {
+		code, res := introspect(t, clientAssertion(t, creds), grant.Token)
+		if code != http.StatusOK || !res.Active {
+			t.Fatalf("unexpected response [%d] %+v", code, res)
+		}
+		if res.TenantID != "tenant" || res.Subject != "1" || res.ClientID != "key" || res.Scope != "tenant:tenant read" {
+			t.Fatalf("unexpected response %+v", res)
+		}
+		if res.Expiry <= res.IssuedAt || res.TokenID == "" {
+			t.Fatalf("unexpected response %+v", res)
+		}
+	})
+
+	t0.Run("other tenant", func(t *testing.T) {
+		other, err := Grant(nb(), c, Authorized{TenantID: "other"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, res := introspect(t, clientAssertion(t, creds), other.Token)
+		if code != http.StatusOK || res.Active {
+			t.Fatalf("unexpected response [%d] %+v", code, res)
+		}
+
+		// the introspect scope allows any tenant
+		code, res = introspect(t, clientAssertion(t, gateway), other.Token)
+		if code != http.StatusOK || !res.Active || res.TenantID != "other" {
+			t.Fatalf("unexpected response [%d] %+v", code, res)
+		}
+	})
+
+	t0.Run("invalid", func(t *testing.T) {
+		code, res := introspect(t, clientAssertion(t, creds), "invalid")
+		if code != http.StatusOK || res.Active || res.TenantID != "" {
+			t.Fatalf("unexpected response [%d] %+v", code, res)
+		}
+	})
+
+	t0.Run("revoked", func(t *testing.T) {
+		revoked, err := Grant(nb(), c, Authorized{TenantID: "tenant"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, res := introspect(t, clientAssertion(t, creds), revoked.Token)
+		if code != http.StatusOK || !res.Active {
+			t.Fatalf("unexpected response [%d] %+v", code, res)
+		}
+
+		form := url.Values{
+			"client_assertion_type": {ClientAssertionType},
+			"client_assertion":      {clientAssertion(t, creds)},
+			"token":                 {revoked.Token},
+		}.Encode()
+		rev, err := http.Post(ts.URL+RevocationPath, "application/x-www-form-urlencoded", strings.NewReader(form))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rev.Body.Close()
+		if rev.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected revoke status [%d]", rev.StatusCode)
+		}
+
+		// inactive at once, with no deny list poll in between
+		code, res = introspect(t, clientAssertion(t, creds), revoked.Token)
+		if code != http.StatusOK || res.Active {
+			t.Fatalf("unexpected response [%d] %+v", code, res)
+		}
+	})
+
+	t0.Run("unauthenticated", func(t *testing.T) {
+		code, _ := introspect(t, "invalid", grant.Token)
+		if code != http.StatusUnauthorized {
+			t.Fatalf("unexpected status [%d]", code)
+		}
+	})
+}
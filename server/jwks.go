@@ -0,0 +1,233 @@
+package server
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"formation.engineering/oauth2-jwt/edge"
+	"formation.engineering/oauth2-jwt/server/admin"
+	"github.com/pkg/errors"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	JWKSPath = "/.well-known/jwks.json"
+
+	// JWKSMaxAge is how long clients may cache the published key set
+	JWKSMaxAge = "max-age=300"
+)
+
+type preparedKeys struct {
+	signing jose.JSONWebKey
+	public  []jose.JSONWebKey
+}
+
+// Prepare computes the signing key and public keys once, an unprepared
+// Config computes them, thumbprints included, on every call. Prepare
+// again after changing PrivateKey, KeyID or VerificationKeys.
+func (x Config) Prepare() (Config, error) {
+	x.keys = nil
+
+	signing, err := x.SigningKey()
+	if err != nil {
+		return x, err
+	}
+	public, err := x.PublicKeys()
+	if err != nil {
+		return x, err
+	}
+
+	x.keys = &preparedKeys{signing: *signing, public: public}
+	return x, nil
+}
+
+// SigningKey is the JWK used to sign issued tokens, the 'kid' is
+// Config.KeyID or the RFC 7638 thumbprint of the key.
+func (x Config) SigningKey() (*jose.JSONWebKey, error) {
+	if x.keys != nil {
+		key := x.keys.signing
+		return &key, nil
+	}
+
+	if x.PrivateKey == nil {
+		return nil, errors.New("missing private key")
+	}
+
+	key := jose.JSONWebKey{
+		Key:       x.PrivateKey,
+		KeyID:     x.KeyID,
+		Algorithm: string(jose.ES256),
+		Use:       "sig",
+	}
+
+	if key.KeyID == "" {
+		kid, err := admin.Thumbprint(key.Public().Key)
+		if err != nil {
+			return nil, err
+		}
+		key.KeyID = kid
+	}
+
+	return &key, nil
+}
+
+// PublicKeys are the signing key and every verification key
+func (x Config) PublicKeys() ([]jose.JSONWebKey, error) {
+	keys, err := x.publicKeys()
+	if err != nil {
+		return nil, err
+	}
+	return append([]jose.JSONWebKey(nil), keys...), nil
+}
+
+// publicKeys may be shared with the prepared keys
+func (x Config) publicKeys() ([]jose.JSONWebKey, error) {
+	if x.keys != nil {
+		return x.keys.public, nil
+	}
+
+	key, err := x.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	keys := []jose.JSONWebKey{key.Public()}
+	for _, v := range x.VerificationKeys {
+		kid := v.KeyID
+		if kid == "" {
+			kid, err = admin.Thumbprint(v.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+		keys = append(keys, jose.JSONWebKey{
+			Key:       v.PublicKey,
+			KeyID:     kid,
+			Algorithm: string(jose.ES256),
+			Use:       "sig",
+		})
+	}
+
+	for _, k := range keys {
+		if !k.IsPublic() || !k.Valid() {
+			return nil, fmt.Errorf("invalid public key [%s]", k.KeyID)
+		}
+	}
+
+	return keys, nil
+}
+
+// Key resolves 'kid' against PublicKeys, so tokens issued by this
+// server can be checked with an edge.Verifier
+func (x Config) Key(kid string) (crypto.PublicKey, error) {
+	keys, err := x.publicKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if k.KeyID == kid {
+			return k.Key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("kid [%s]: %w", kid, edge.UnknownKeyID)
+}
+
+// JWKS is the public key set edge services use to verify issued tokens
+// https://tools.ietf.org/html/rfc7517#section-5
+func (x Config) JWKS() (*jose.JSONWebKeySet, error) {
+	keys, err := x.PublicKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return &jose.JSONWebKeySet{Keys: keys}, nil
+}
+
+// ConfigFromKeyRing signs with the active key and publishes the others,
+// the Config is prepared
+func ConfigFromKeyRing(ring admin.KeyRing) (*Config, error) {
+	active, err := ring.Active()
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := active.Load()
+	if err != nil {
+		return nil, errors.WithMessagef(err, "load key [%s]", active.KeyID)
+	}
+
+	c := Config{
+		PrivateKey: privateKey,
+		KeyID:      active.KeyID,
+	}
+
+	for _, k := range ring.Keys {
+		if k.Status == admin.Active {
+			continue
+		}
+		key, err := k.Load()
+		if err != nil {
+			return nil, errors.WithMessagef(err, "load key [%s]", k.KeyID)
+		}
+		c.VerificationKeys = append(c.VerificationKeys, VerificationKey{
+			KeyID:     k.KeyID,
+			PublicKey: key.Public(),
+		})
+	}
+
+	c, err = c.Prepare()
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// JWKSHandler publishes Config.JWKS
+type JWKSHandler struct {
+	NewBuilder NewBuilder
+	Config     Config
+}
+
+func NewJWKSHandler(nb NewBuilder, c Config) *JWKSHandler {
+	return &JWKSHandler{
+		NewBuilder: nb,
+		Config:     c,
+	}
+}
+
+func (x *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := x.NewBuilder()
+	defer b.Push()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		b.String("method", r.Method)
+		b.String("error_message", "method must be GET or HEAD")
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	set, err := x.Config.JWKS()
+	if err != nil {
+		b.String("error_message", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(set)
+	if err != nil {
+		b.String("error_message", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b.Int("keys", len(set.Keys))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, "+JWKSMaxAge)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(payload)
+}
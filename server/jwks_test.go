@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/server/admin"
+)
+
+func TestJWKS(t *testing.T) {
+	b := telemetry.NewTestingBuilder(t)
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Config{PrivateKey: serverCreds.PrivateKey}
+
+	ts := httptest.NewServer(NewServeMux(func() telemetry.Builder { return b }, c, emptyStore))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + JWKSPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status [%d]", res.StatusCode)
+	}
+
+	var set jose.JSONWebKeySet
+	err = json.NewDecoder(res.Body).Decode(&set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 || !set.Keys[0].IsPublic() || set.Keys[0].KeyID == "" {
+		t.Fatalf("unexpected key set %v", set)
+	}
+
+	grant, err := Grant(b, c, Authorized{TenantID: "tenant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := jwt.ParseSigned(grant.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kid := parsed.Headers[0].KeyID
+	keys := set.Key(kid)
+	if len(keys) != 1 {
+		t.Fatalf("issued 'kid' [%s] not published", kid)
+	}
+
+	var claims jwt.Claims
+	err = parsed.Claims(keys[0], &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWKSKeyID(t *testing.T) {
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := Config{PrivateKey: serverCreds.PrivateKey, KeyID: "2020-08"}.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Key("2020-08")) != 1 {
+		t.Fatalf("unexpected key set %v", set)
+	}
+}
+
+func TestJWKSKeyRing(t *testing.T) {
+	b := telemetry.NewTestingBuilder(t)
+	creds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := admin.LoadKeyRing(creds.RenderPrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := ConfigFromKeyRing(*ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant, err := Grant(b, *before, Authorized{TenantID: "tenant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ring.Publish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ring.Activate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := ConfigFromKeyRing(*ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := after.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected active and previous key, found %d", len(set.Keys))
+	}
+
+	// Tokens signed before the rotation still verify
+	parsed, err := jwt.ParseSigned(grant.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := set.Key(parsed.Headers[0].KeyID)
+	if len(keys) != 1 {
+		t.Fatal("previous key not published")
+	}
+	var claims jwt.Claims
+	err = parsed.Claims(keys[0], &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWKSPrepared(t *testing.T) {
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Config{PrivateKey: serverCreds.PrivateKey}.Prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := c.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 7638 thumbprints are unpadded base64url
+	if len(key.KeyID) != 43 || strings.ContainsAny(key.KeyID, "=+/") {
+		t.Fatalf("unexpected 'kid' [%s]", key.KeyID)
+	}
+
+	// the prepared keys are not shared with callers
+	keys, err := c.PublicKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys[0].KeyID = "changed"
+	key.KeyID = "changed"
+
+	if _, err := c.Key("changed"); err == nil {
+		t.Fatal("expected unknown 'kid'")
+	}
+	again, err := c.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Key(again.KeyID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Config{}.Prepare()
+	if err == nil {
+		t.Fatal("expected missing private key")
+	}
+}
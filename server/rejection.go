@@ -0,0 +1,137 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Rejection is why an assertion was rejected, it is logged and can be
+// matched with errors.Is(err, LifetimeExceeded)
+type Rejection string
+
+const (
+	MissingClaim     Rejection = "missing_claim"
+	LifetimeExceeded Rejection = "lifetime_exceeded"
+	IssuedInFuture   Rejection = "issued_in_future"
+	Expired          Rejection = "expired"
+	NotValidYet      Rejection = "not_valid_yet"
+	InvalidIssuer    Rejection = "invalid_issuer"
+	InvalidAudience  Rejection = "invalid_audience"
+	InvalidClaims    Rejection = "invalid_claims"
+	Replayed         Rejection = "replayed"
+
+	// The key is rejected as 'invalid_client'
+	DisabledKey Rejection = "key_disabled"
+	RevokedKey  Rejection = "key_revoked"
+	ExpiredKey  Rejection = "key_expired"
+)
+
+func (x Rejection) Error() string {
+	return string(x)
+}
+
+func reject(reason Rejection, description string, err error) *Error {
+	return &Error{
+		Code:        InvalidGrant,
+		Description: description,
+		Reason:      reason,
+		Err:         err,
+	}
+}
+
+func (x Config) clockSkew() time.Duration {
+	if x.ClockSkew > 0 {
+		return x.ClockSkew
+	}
+	return jwt.DefaultLeeway
+}
+
+func rejectKey(reason Rejection, description string) *Error {
+	return &Error{
+		Code:        InvalidClient,
+		Description: description,
+		Reason:      reason,
+	}
+}
+
+func checkKeyStatus(key *store.KeyInfo, now time.Time) error {
+	switch key.Status {
+	case "", store.KeyActive:
+	case store.KeyRevoked:
+		return rejectKey(RevokedKey, "key is revoked")
+	default:
+		return rejectKey(DisabledKey, "key is disabled")
+	}
+
+	if !key.ExpiresAt.IsZero() && !now.Before(key.ExpiresAt) {
+		return rejectKey(ExpiredKey, "key is expired")
+	}
+	return nil
+}
+
+func checkRequiredClaims(c Config, claims map[string]interface{}) error {
+	for _, name := range c.RequiredClaims {
+		if _, ok := claims[name]; !ok {
+			return reject(MissingClaim, fmt.Sprintf("missing '%s' claim", name), nil)
+		}
+	}
+	return nil
+}
+
+func checkAudience(c Config, policy *store.KeyPolicy, claims jwt.Claims) error {
+	if !containsAny(claims.Audience, c.assertionAudiences()) {
+		return reject(InvalidAudience, "assertion 'aud' is invalid", jwt.ErrInvalidAudience)
+	}
+	if policy != nil && len(policy.Audiences) > 0 && !containsAny(claims.Audience, policy.Audiences) {
+		return reject(InvalidAudience, "assertion 'aud' is not allowed for the key", jwt.ErrInvalidAudience)
+	}
+	return nil
+}
+
+func containsAny(aud jwt.Audience, accepted []string) bool {
+	for _, a := range accepted {
+		if aud.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLifetime is exact, ClockSkew is not applied
+func checkLifetime(c Config, claims jwt.Claims, now time.Time) error {
+	if c.MaxAssertionLifetime <= 0 || claims.Expiry == nil {
+		return nil
+	}
+
+	from := now
+	if claims.IssuedAt != nil {
+		from = claims.IssuedAt.Time()
+	}
+
+	lifetime := claims.Expiry.Time().Sub(from)
+	if lifetime > c.MaxAssertionLifetime {
+		return reject(LifetimeExceeded, fmt.Sprintf("assertion lifetime is larger than the maximum allowed: %s > %s", lifetime, c.MaxAssertionLifetime), nil)
+	}
+	return nil
+}
+
+func rejectValidation(err error) *Error {
+	switch {
+	case errors.Is(err, jwt.ErrExpired):
+		return reject(Expired, "assertion is expired", err)
+	case errors.Is(err, jwt.ErrNotValidYet):
+		return reject(NotValidYet, "assertion is not valid yet", err)
+	case errors.Is(err, jwt.ErrIssuedInTheFuture):
+		return reject(IssuedInFuture, "assertion is issued in the future", err)
+	case errors.Is(err, jwt.ErrInvalidIssuer):
+		return reject(InvalidIssuer, "assertion 'iss' does not match key", err)
+	case errors.Is(err, jwt.ErrInvalidAudience):
+		return reject(InvalidAudience, "assertion 'aud' is invalid", err)
+	default:
+		return reject(InvalidClaims, "assertion claims are invalid", err)
+	}
+}
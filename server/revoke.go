@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/edge"
+	"formation.engineering/oauth2-jwt/store"
+)
+
+const (
+	RevocationPath = "/revoke"
+
+	// RevokedPath publishes the unexpired revocations, polled by
+	// edge.PollingDenyList
+	RevokedPath = "/revoked"
+
+	// RevokedScope a token must carry to read RevokedPath, the list spans
+	// every tenant
+	RevokedScope = "revoked"
+)
+
+// RevocationHandler serves the token revocation endpoint, a client may
+// revoke any token issued to its own tenant.
+// https://tools.ietf.org/html/rfc7009
+type RevocationHandler struct {
+	NewBuilder     NewBuilder
+	Config         Config
+	Store          store.ReadOnlyStore
+	Revocations    store.RevocationStore
+	MaxRequestSize int64
+}
+
+func NewRevocationHandler(nb NewBuilder, c Config, x store.ReadOnlyStore, r store.RevocationStore) *RevocationHandler {
+	return &RevocationHandler{
+		NewBuilder:     nb,
+		Config:         c,
+		Store:          x,
+		Revocations:    r,
+		MaxRequestSize: MaxRequestSize,
+	}
+}
+
+// HandleRevocation adds the revocation and revoked list endpoints to mux
+func HandleRevocation(mux *http.ServeMux, nb NewBuilder, c Config, x store.ReadOnlyStore, r store.RevocationStore) {
+	mux.Handle(RevocationPath, NewRevocationHandler(nb, c, x, r))
+	mux.Handle(RevokedPath, NewRevokedHandler(nb, c, r))
+}
+
+func (x *RevocationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := x.NewBuilder()
+	defer b.Push()
+
+	if !formPost(b, w, r, x.MaxRequestSize) {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, logError(b, bodyError("unable to parse body", err)))
+		return
+	}
+
+	client, err := AuthenticateClient(b, x.Config, x.Store, r.PostForm)
+	if err != nil {
+		writeError(w, logError(b, AsError(err)))
+		return
+	}
+
+	err = Revoke(b, x.Config, x.Revocations, *client, r.PostForm.Get("token"))
+	if err != nil {
+		writeError(w, logError(b, AsError(err)))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, []byte("{}"))
+}
+
+// Revoke records token as revoked. Invalid and expired tokens are
+// ignored, as they can no longer be used.
+// https://tools.ietf.org/html/rfc7009#section-2.2
+func Revoke(b telemetry.Builder, c Config, r store.RevocationStore, client Authorized, token string) error {
+	if token == "" {
+		return newError(InvalidRequest, "missing 'token'", nil)
+	}
+
+	p, err := c.Verifier(nil).Verify(b, token)
+	if err != nil {
+		b.String("revoke_ignored", err.Error())
+		return nil
+	}
+
+	if p.TenantID != client.TenantID {
+		return newError(UnauthorizedClient, "token was not issued to the client tenant", nil)
+	}
+
+	err = r.Revoke(store.Revocation{
+		TokenID:  p.TokenID,
+		TenantID: p.TenantID,
+		Expiry:   p.Expiry,
+	})
+	if err != nil {
+		return newError(ServerError, "", fmt.Errorf("revoke: %w", err))
+	}
+
+	b.String("revoked_token_id", p.TokenID)
+	return nil
+}
+
+type RevokedResponse struct {
+	Revoked []RevokedToken `json:"revoked"`
+}
+
+type RevokedToken struct {
+	TenantID string `json:"tenant_id"`
+	TokenID  string `json:"jti"`
+	Expiry   int64  `json:"exp"`
+}
+
+// RevokedHandler publishes the revoked token IDs to bearers of a token
+// granted with the RevokedScope, i.e. edge services
+type RevokedHandler struct {
+	NewBuilder  NewBuilder
+	Config      Config
+	Revocations store.RevocationStore
+}
+
+func NewRevokedHandler(nb NewBuilder, c Config, r store.RevocationStore) *RevokedHandler {
+	return &RevokedHandler{
+		NewBuilder:  nb,
+		Config:      c,
+		Revocations: r,
+	}
+}
+
+func (x *RevokedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := x.NewBuilder()
+	defer b.Push()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		b.String("method", r.Method)
+		b.String("error_message", "method must be GET or HEAD")
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts := edge.MiddlewareOptions{
+		Keys:           x.Config,
+		RequiredScopes: []string{RevokedScope},
+		Issuer:         x.Config.issuer(),
+		Audience:       x.Config.audience(),
+	}
+	_, berr := edge.Authenticate(b, opts, r.Header.Get("Authorization"))
+	if berr != nil {
+		b.String("error_message", berr.Error())
+		edge.WriteBearerError(w, "", berr)
+		return
+	}
+
+	revoked, err := x.Revocations.ListRevoked(time.Now())
+	if err != nil {
+		b.String("error_message", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res := RevokedResponse{Revoked: make([]RevokedToken, 0, len(revoked))}
+	for _, t := range revoked {
+		res.Revoked = append(res.Revoked, RevokedToken{
+			TenantID: t.TenantID,
+			TokenID:  t.TokenID,
+			Expiry:   t.Expiry.Unix(),
+		})
+	}
+
+	payload, err := json.Marshal(res)
+	if err != nil {
+		b.String("error_message", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b.Int("revoked", len(res.Revoked))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(payload)
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"formation.engineering/library/lib/telemetry/v1"
+	"formation.engineering/oauth2-jwt/edge"
+	"formation.engineering/oauth2-jwt/server/admin"
+	"formation.engineering/oauth2-jwt/server/client"
+	"formation.engineering/oauth2-jwt/store/memory"
+)
+
+func TestRevocationHandler(t0 *testing.T) {
+	nb := func() telemetry.Builder { return telemetry.NewTestingBuilder(t0) }
+	s1 := memory.NewMemoryStore()
+	creds, _ := newTestKey(t0, s1, testRequest("tenant"))
+	serverCreds, err := admin.GenerateServerCredentials()
+	if err != nil {
+		t0.Fatal(err)
+	}
+	c := Config{PrivateKey: serverCreds.PrivateKey}
+	revocations := memory.NewRevocationStore()
+
+	mux := NewServeMux(nb, c, s1)
+	HandleRevocation(mux, nb, c, s1, revocations)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	assertion := clientAssertion(t0, creds)
+
+	edgeToken := func(t *testing.T) string {
+		res, err := Grant(nb(), c, Authorized{TenantID: "edge", Scopes: []string{RevokedScope}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Token
+	}
+
+	revoke := func(t *testing.T, assertion, token string) (*http.Response, []byte) {
+		form := url.Values{
+			"client_assertion_type": {ClientAssertionType},
+			"client_assertion":      {assertion},
+			"token":                 {token},
+		}.Encode()
+		res, err := http.Post(ts.URL+RevocationPath, "application/x-www-form-urlencoded", strings.NewReader(form))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		payload, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, payload
+	}
+
+	grant := func(t *testing.T, tenant string) (string, *edge.Principal) {
+		res, err := Grant(nb(), c, Authorized{TenantID: tenant})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := edge.Verifier{Keys: c}.Verify(nb(), res.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Token, p
+	}
+
+	t0.Run("success", func(t *testing.T) {
+		token, p := grant(t, "tenant")
+		res, body := revoke(t, assertion, token)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected response [%d] %s", res.StatusCode, body)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		deny := edge.NewPollingDenyList(ctx, ts.URL+RevokedPath, edge.DenyListOptions{
+			Interval: time.Hour,
+			Client:   oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: edgeToken(t)})),
+		})
+		if err := deny.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		if !deny.Revoked(p.TenantID, p.TokenID) {
+			t.Fatalf("expected [%s] to be revoked", p.TokenID)
+		}
+	})
+
+	t0.Run("other tenant", func(t *testing.T) {
+		token, _ := grant(t, "other")
+		res, body := revoke(t, assertion, token)
+		if res.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), `"unauthorized_client"`) {
+			t.Fatalf("unexpected response [%d] %s", res.StatusCode, body)
+		}
+	})
+
+	t0.Run("invalid token", func(t *testing.T) {
+		res, body := revoke(t, assertion, "invalid")
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected response [%d] %s", res.StatusCode, body)
+		}
+	})
+
+	t0.Run("invalid client", func(t *testing.T) {
+		token, _ := grant(t, "tenant")
+		res, body := revoke(t, "invalid", token)
+		if res.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), `"invalid_client"`) {
+			t.Fatalf("unexpected response [%d] %s", res.StatusCode, body)
+		}
+	})
+
+	t0.Run("revoked list", func(t *testing.T) {
+		list := func(t *testing.T, token string) (*http.Response, RevokedResponse) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+RevokedPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			var out RevokedResponse
+			if res.StatusCode == http.StatusOK {
+				if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return res, out
+		}
+
+		res, _ := list(t, "")
+		if res.StatusCode != http.StatusUnauthorized || res.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Fatalf("unexpected response [%d]", res.StatusCode)
+		}
+
+		// a tenant token can't read the revocations of every tenant
+		token, _ := grant(t, "tenant")
+		res, _ = list(t, token)
+		if res.StatusCode != http.StatusForbidden {
+			t.Fatalf("unexpected response [%d]", res.StatusCode)
+		}
+
+		res, out := list(t, edgeToken(t))
+		if res.StatusCode != http.StatusOK || len(out.Revoked) != 1 {
+			t.Fatalf("unexpected response [%d] %+v", res.StatusCode, out)
+		}
+	})
+}
+
+// clientAssertion signs an assertion authenticating creds
+func clientAssertion(t *testing.T, creds *client.Credentials) string {
+	t.Helper()
+	now := time.Now()
+	return signTest(t, newTestSigner(t, creds), jwt.Claims{
+		Issuer:   creds.IdentityID,
+		Audience: jwt.Audience{"formation"},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(time.Minute)),
+	})
+}
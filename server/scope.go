@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+const TenantScopePrefix = "tenant:"
+
+// TenantScope is granted on every token, edge services read the tenant
+// from it
+func TenantScope(tenant TenantID) string {
+	return TenantScopePrefix + tenant
+}
+
+// isTenantScope is only granted by TenantScope, never requested or stored
+func isTenantScope(scope string) bool {
+	return strings.HasPrefix(scope, TenantScopePrefix)
+}
+
+// withoutTenantScopes drops tenant scopes, of keys stored before they were
+// rejected
+func withoutTenantScopes(scopes []string) []string {
+	var kept []string
+	for _, s := range scopes {
+		if !isTenantScope(s) {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// grantScopes returns the requested scopes allowed on the key, every
+// allowed scope is granted when none are requested. Keys without allowed
+// scopes are only granted the tenant scope. Requesting a tenant scope is
+// invalid, the tenant is that of the key.
+// https://tools.ietf.org/html/rfc6749#section-3.3
+func grantScopes(requested string, allowed []string) ([]string, error) {
+	fields := strings.Fields(requested)
+	for _, s := range fields {
+		if isTenantScope(s) {
+			return nil, newError(InvalidScope, fmt.Sprintf("scope [%s] is reserved", s), nil)
+		}
+	}
+
+	allowed = withoutTenantScopes(allowed)
+	if len(allowed) == 0 {
+		return nil, nil
+	}
+
+	if len(fields) == 0 {
+		return append([]string(nil), allowed...), nil
+	}
+
+	permitted := make(map[string]bool, len(allowed))
+	for _, s := range allowed {
+		permitted[s] = true
+	}
+
+	var granted []string
+	seen := make(map[string]bool, len(fields))
+	for _, s := range fields {
+		if permitted[s] && !seen[s] {
+			granted = append(granted, s)
+		}
+		seen[s] = true
+	}
+
+	if len(granted) == 0 {
+		return nil, newError(InvalidScope, fmt.Sprintf("requested scope [%s] is not allowed", requested), nil)
+	}
+
+	return granted, nil
+}
+
+// limitScopes returns the scopes in allowed, all of them when allowed is
+// empty
+func limitScopes(scopes, allowed []string) []string {
+	if len(allowed) == 0 {
+		return scopes
+	}
+
+	var limited []string
+	for _, s := range scopes {
+		for _, a := range allowed {
+			if s == a {
+				limited = append(limited, s)
+				break
+			}
+		}
+	}
+	return limited
+}
@@ -0,0 +1,353 @@
+package store
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"formation.engineering/library/lib/telemetry/v1"
+)
+
+const (
+	// DefaultCacheSize is the number of keys held by a CachedStore
+	DefaultCacheSize = 10000
+
+	// DefaultCacheTTL bounds how long a disabled or revoked key is still
+	// accepted when its invalidation is missed, see WithInvalidation
+	DefaultCacheTTL = time.Minute
+
+	// DefaultNegativeCacheTTL of unknown key ids
+	DefaultNegativeCacheTTL = 10 * time.Second
+)
+
+type CacheOptions struct {
+	// Size defaults to DefaultCacheSize, the least recently used key is
+	// evicted when full
+	Size int
+
+	// TTL defaults to DefaultCacheTTL. It is how long a disabled, revoked
+	// or deleted key is still accepted unless the change is made through
+	// WithInvalidation in the same process, i.e. always when keys are
+	// managed by a separate admin service.
+	TTL time.Duration
+
+	// NegativeTTL defaults to DefaultNegativeCacheTTL, so a flood of
+	// unknown key ids doesn't reach the store
+	NegativeTTL time.Duration
+}
+
+// lookupPanicked is returned to the lookups sharing a flight whose store
+// lookup panicked
+var lookupPanicked = errors.New("key lookup panicked")
+
+// Reporter is optionally implemented by a ReadOnlyStore to log its
+// metrics with every lookup
+type Reporter interface {
+	Report(b telemetry.Builder)
+}
+
+// CachedStore is a ReadOnlyStore caching another. Concurrent misses of
+// the same key id share a single lookup, errors are not cached.
+type CachedStore struct {
+	store ReadOnlyStore
+	opts  CacheOptions
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[KeyID]*list.Element
+	lru     *list.List
+	flights map[KeyID]*flight
+
+	hits         int64
+	negativeHits int64
+	misses       int64
+	evictions    int64
+}
+
+type cacheEntry struct {
+	keyid   KeyID
+	info    *KeyInfo // nil for an unknown key id
+	expires time.Time
+}
+
+// flight is a lookup shared by concurrent misses
+type flight struct {
+	done        chan struct{}
+	info        *KeyInfo
+	err         error
+	invalidated bool
+}
+
+// CacheStats counts lookups, a miss shared by concurrent lookups is a
+// single miss and a hit for every other
+type CacheStats struct {
+	Hits         int64
+	NegativeHits int64
+	Misses       int64
+	Evictions    int64
+	Size         int
+}
+
+// Cached wraps s, see CacheOptions for the defaults
+func Cached(s ReadOnlyStore, opts CacheOptions) *CachedStore {
+	if opts.Size <= 0 {
+		opts.Size = DefaultCacheSize
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultCacheTTL
+	}
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = DefaultNegativeCacheTTL
+	}
+
+	return &CachedStore{
+		store:   s,
+		opts:    opts,
+		now:     time.Now,
+		entries: make(map[KeyID]*list.Element),
+		lru:     list.New(),
+		flights: make(map[KeyID]*flight),
+	}
+}
+
+func (x *CachedStore) GetKey(keyid KeyID) (*KeyInfo, error) {
+	x.mu.Lock()
+
+	if entry, ok := x.lookup(keyid); ok {
+		x.mu.Unlock()
+		if entry.info == nil {
+			atomic.AddInt64(&x.negativeHits, 1)
+			return nil, nil
+		}
+		atomic.AddInt64(&x.hits, 1)
+		return copyKeyInfo(entry.info), nil
+	}
+
+	if f, ok := x.flights[keyid]; ok {
+		x.mu.Unlock()
+		<-f.done
+		atomic.AddInt64(&x.hits, 1)
+		return copyKeyInfo(f.info), f.err
+	}
+
+	// err is replaced by the lookup, so waiters see lookupPanicked if it
+	// panics
+	f := &flight{done: make(chan struct{}), err: lookupPanicked}
+	x.flights[keyid] = f
+	x.mu.Unlock()
+
+	defer x.land(keyid, f)
+
+	atomic.AddInt64(&x.misses, 1)
+	f.info, f.err = x.store.GetKey(keyid)
+
+	return copyKeyInfo(f.info), f.err
+}
+
+// land closes the flight, caching its result unless it failed or was
+// invalidated
+func (x *CachedStore) land(keyid KeyID, f *flight) {
+	x.mu.Lock()
+	delete(x.flights, keyid)
+	if f.err == nil && !f.invalidated {
+		x.add(keyid, f.info)
+	}
+	x.mu.Unlock()
+	close(f.done)
+}
+
+// Invalidate drops keyid, including a lookup in flight, so the next
+// GetKey reads the store
+func (x *CachedStore) Invalidate(keyid KeyID) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if elem, ok := x.entries[keyid]; ok {
+		x.remove(elem)
+	}
+	if f, ok := x.flights[keyid]; ok {
+		f.invalidated = true
+	}
+}
+
+// KeyUsed is passed through, so a cached store still records usage
+func (x *CachedStore) KeyUsed(keyid KeyID, at time.Time) error {
+	usage, ok := x.store.(UsageRecorder)
+	if !ok {
+		return nil
+	}
+	return usage.KeyUsed(keyid, at)
+}
+
+// FlushUsage is passed through, see UsageFlusher
+func (x *CachedStore) FlushUsage() error {
+	flusher, ok := x.store.(UsageFlusher)
+	if !ok {
+		return nil
+	}
+	return flusher.FlushUsage()
+}
+
+func (x *CachedStore) Stats() CacheStats {
+	x.mu.Lock()
+	size := x.lru.Len()
+	x.mu.Unlock()
+
+	return CacheStats{
+		Hits:         atomic.LoadInt64(&x.hits),
+		NegativeHits: atomic.LoadInt64(&x.negativeHits),
+		Misses:       atomic.LoadInt64(&x.misses),
+		Evictions:    atomic.LoadInt64(&x.evictions),
+		Size:         size,
+	}
+}
+
+// Report logs the counters since the cache was created
+func (x *CachedStore) Report(b telemetry.Builder) {
+	stats := x.Stats()
+	b.Int("key_cache_hits", int(stats.Hits))
+	b.Int("key_cache_negative_hits", int(stats.NegativeHits))
+	b.Int("key_cache_misses", int(stats.Misses))
+	b.Int("key_cache_evictions", int(stats.Evictions))
+	b.Int("key_cache_size", stats.Size)
+}
+
+// lookup requires the lock, an expired entry is dropped
+func (x *CachedStore) lookup(keyid KeyID) (*cacheEntry, bool) {
+	elem, ok := x.entries[keyid]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !x.now().Before(entry.expires) {
+		x.remove(elem)
+		return nil, false
+	}
+
+	x.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// add requires the lock
+func (x *CachedStore) add(keyid KeyID, info *KeyInfo) {
+	ttl := x.opts.TTL
+	if info == nil {
+		ttl = x.opts.NegativeTTL
+	}
+	entry := &cacheEntry{keyid: keyid, info: copyKeyInfo(info), expires: x.now().Add(ttl)}
+
+	if elem, ok := x.entries[keyid]; ok {
+		elem.Value = entry
+		x.lru.MoveToFront(elem)
+		return
+	}
+
+	x.entries[keyid] = x.lru.PushFront(entry)
+	for x.lru.Len() > x.opts.Size {
+		x.remove(x.lru.Back())
+		atomic.AddInt64(&x.evictions, 1)
+	}
+}
+
+// remove requires the lock
+func (x *CachedStore) remove(elem *list.Element) {
+	x.lru.Remove(elem)
+	delete(x.entries, elem.Value.(*cacheEntry).keyid)
+}
+
+// copyKeyInfo so callers can't change a cached key, the public key is
+// never changed so it is shared
+func copyKeyInfo(info *KeyInfo) *KeyInfo {
+	if info == nil {
+		return nil
+	}
+	out := *info
+	out.Scopes = copyStrings(info.Scopes)
+	if info.Policy != nil {
+		policy := *info.Policy
+		policy.Audiences = copyStrings(info.Policy.Audiences)
+		policy.Scopes = copyStrings(info.Policy.Scopes)
+		out.Policy = &policy
+	}
+	return &out
+}
+
+func copyStrings(x []string) []string {
+	if x == nil {
+		return nil
+	}
+	return append([]string(nil), x...)
+}
+
+// InvalidatingStore calls its hooks once a key is added, disabled,
+// enabled, revoked or deleted, i.e. CachedStore.Invalidate. Adds drop a
+// negatively cached key id.
+type InvalidatingStore struct {
+	Store
+	hooks []func(KeyID)
+}
+
+// WithInvalidation wraps s, calling every hook after an add, status
+// change or delete succeeds
+func WithInvalidation(s Store, hooks ...func(KeyID)) *InvalidatingStore {
+	return &InvalidatingStore{Store: s, hooks: hooks}
+}
+
+func (x *InvalidatingStore) AddKey(keyid KeyID, info AddKey) (*IdentityID, error) {
+	id, err := x.Store.AddKey(keyid, info)
+	if err == nil {
+		x.invalidate(keyid)
+	}
+	return id, err
+}
+
+func (x *InvalidatingStore) AddIdentityKey(identityID IdentityID, keyid KeyID, info AddKey) error {
+	err := x.Store.AddIdentityKey(identityID, keyid, info)
+	if err == nil {
+		x.invalidate(keyid)
+	}
+	return err
+}
+
+func (x *InvalidatingStore) SetKeyStatus(keyid KeyID, change StatusChange) error {
+	err := x.Store.SetKeyStatus(keyid, change)
+	if err == nil {
+		x.invalidate(keyid)
+	}
+	return err
+}
+
+func (x *InvalidatingStore) DeleteKey(keyid KeyID) error {
+	err := x.Store.DeleteKey(keyid)
+	if err == nil {
+		x.invalidate(keyid)
+	}
+	return err
+}
+
+// KeyUsed is passed through, so a wrapped store still records usage
+func (x *InvalidatingStore) KeyUsed(keyid KeyID, at time.Time) error {
+	usage, ok := x.Store.(UsageRecorder)
+	if !ok {
+		return nil
+	}
+	return usage.KeyUsed(keyid, at)
+}
+
+// FlushUsage is passed through, see UsageFlusher
+func (x *InvalidatingStore) FlushUsage() error {
+	flusher, ok := x.Store.(UsageFlusher)
+	if !ok {
+		return nil
+	}
+	return flusher.FlushUsage()
+}
+
+func (x *InvalidatingStore) invalidate(keyid KeyID) {
+	for _, hook := range x.hooks {
+		hook(keyid)
+	}
+}
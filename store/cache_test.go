@@ -0,0 +1,269 @@
+package store
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingStore struct {
+	Store
+	keys    map[KeyID]*KeyInfo
+	calls   int64
+	gate    chan struct{}
+	err     error
+	panics  bool
+	flushes int
+}
+
+func (x *countingStore) GetKey(keyid KeyID) (*KeyInfo, error) {
+	atomic.AddInt64(&x.calls, 1)
+	if x.gate != nil {
+		<-x.gate
+	}
+	if x.panics {
+		panic("lookup")
+	}
+	if x.err != nil {
+		return nil, x.err
+	}
+	return x.keys[keyid], nil
+}
+
+func (x *countingStore) AddKey(keyid KeyID, info AddKey) (*IdentityID, error) {
+	x.keys[keyid] = &KeyInfo{TenantID: info.TenantID, Status: KeyActive}
+	id := IdentityID("1")
+	return &id, nil
+}
+
+func (x *countingStore) SetKeyStatus(keyid KeyID, change StatusChange) error {
+	x.keys[keyid].Status = change.Status
+	return nil
+}
+
+func (x *countingStore) FlushUsage() error {
+	x.flushes++
+	return x.err
+}
+
+func TestCachedStore(t0 *testing.T) {
+	backing := &countingStore{keys: map[KeyID]*KeyInfo{
+		"a": {TenantID: "9999", Status: KeyActive, Scopes: []string{"read"}, Policy: &KeyPolicy{Audiences: []string{"formation"}, Scopes: []string{"read"}}},
+		"b": {TenantID: "9999", Status: KeyActive},
+	}}
+	now := time.Now()
+	x := Cached(backing, CacheOptions{Size: 1, TTL: time.Minute, NegativeTTL: time.Second})
+	x.now = func() time.Time { return now }
+
+	get := func(t *testing.T, keyid KeyID, calls int64) *KeyInfo {
+		info, err := x.GetKey(keyid)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if backing.calls != calls {
+			t.Fatalf("get key [%s]: expected [%d] store calls got [%d]", keyid, calls, backing.calls)
+		}
+		return info
+	}
+
+	t0.Run("hit", func(t *testing.T) {
+		get(t, "a", 1)
+		info := get(t, "a", 1)
+		if info == nil || info.TenantID != "9999" {
+			t.Fatalf("expected key [a] got %+v", info)
+		}
+
+		// copies are returned
+		info.TenantID = "other"
+		info.Scopes[0] = "admin"
+		info.Policy.Audiences[0] = "other"
+		info.Policy.Scopes[0] = "write"
+		info.Policy.MaxLifetime = time.Hour
+		cached := get(t, "a", 1)
+		if cached.TenantID != "9999" || cached.Scopes[0] != "read" || cached.Policy.Audiences[0] != "formation" || cached.Policy.Scopes[0] != "read" || cached.Policy.MaxLifetime != 0 {
+			t.Fatalf("expected cached key to be unchanged got %+v %+v", cached, cached.Policy)
+		}
+	})
+
+	t0.Run("ttl", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		get(t, "a", 2)
+	})
+
+	t0.Run("negative", func(t *testing.T) {
+		if get(t, "missing", 3) != nil {
+			t.Fatal("expected missing key")
+		}
+		get(t, "missing", 3)
+
+		now = now.Add(time.Second)
+		get(t, "missing", 4)
+	})
+
+	t0.Run("lru", func(t *testing.T) {
+		get(t, "b", 5)
+		get(t, "b", 5)
+		get(t, "a", 6)
+	})
+
+	t0.Run("invalidation", func(t *testing.T) {
+		s := WithInvalidation(backing, x.Invalidate)
+		get(t, "a", 6)
+
+		err := s.SetKeyStatus("a", StatusChange{Status: KeyDisabled})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if info := get(t, "a", 7); info.Status != KeyDisabled {
+			t.Fatalf("expected disabled key got %+v", info)
+		}
+	})
+
+	t0.Run("errors", func(t *testing.T) {
+		backing.err = errors.New("unavailable")
+		defer func() { backing.err = nil }()
+
+		_, err := x.GetKey("c")
+		if err == nil {
+			t.Fatal("expected store error")
+		}
+		_, err = x.GetKey("c")
+		if err == nil || backing.calls != 9 {
+			t.Fatalf("expected errors to not be cached, [%d] calls [%v]", backing.calls, err)
+		}
+	})
+
+	t0.Run("add", func(t *testing.T) {
+		s := WithInvalidation(backing, x.Invalidate)
+		if get(t, "new", 10) != nil {
+			t.Fatal("expected missing key")
+		}
+		get(t, "new", 10)
+
+		_, err := s.AddKey("new", AddKey{TenantID: "9999"})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if info := get(t, "new", 11); info == nil {
+			t.Fatal("expected added key to be found")
+		}
+	})
+
+	stats := x.Stats()
+	if stats.Misses != 11 || stats.Hits != 4 || stats.NegativeHits != 2 || stats.Evictions == 0 || stats.Size != 1 {
+		t0.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCachedStoreSingleflight(t *testing.T) {
+	backing := &countingStore{
+		keys: map[KeyID]*KeyInfo{"a": {TenantID: "9999"}},
+		gate: make(chan struct{}),
+	}
+	x := Cached(backing, CacheOptions{})
+
+	const lookups = 16
+	var wg sync.WaitGroup
+	for i := 0; i < lookups; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info, err := x.GetKey("a")
+			if err != nil || info == nil {
+				t.Errorf("expected key [a] got %+v [%v]", info, err)
+			}
+		}()
+	}
+
+	// let every lookup join the flight before it lands
+	for {
+		x.mu.Lock()
+		_, inFlight := x.flights["a"]
+		x.mu.Unlock()
+		if inFlight {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(backing.gate)
+	wg.Wait()
+
+	if backing.calls != 1 {
+		t.Fatalf("expected a single store call got [%d]", backing.calls)
+	}
+	if stats := x.Stats(); stats.Misses != 1 || stats.Hits != lookups-1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCachedStorePanic(t *testing.T) {
+	backing := &countingStore{
+		keys:   map[KeyID]*KeyInfo{"a": {TenantID: "9999"}},
+		gate:   make(chan struct{}),
+		panics: true,
+	}
+	x := Cached(backing, CacheOptions{})
+
+	leader := make(chan interface{})
+	go func() {
+		defer func() { leader <- recover() }()
+		_, _ = x.GetKey("a")
+	}()
+
+	for {
+		x.mu.Lock()
+		_, inFlight := x.flights["a"]
+		x.mu.Unlock()
+		if inFlight {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	waiter := make(chan error)
+	go func() {
+		_, err := x.GetKey("a")
+		waiter <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(backing.gate)
+
+	if r := <-leader; r == nil {
+		t.Fatal("expected the leader to panic")
+	}
+	select {
+	case err := <-waiter:
+		if !errors.Is(err, lookupPanicked) {
+			t.Fatalf("expected [%v] got [%v]", lookupPanicked, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the waiter to be released")
+	}
+
+	// nothing is cached, the next lookup reads the store
+	backing.panics = false
+	info, err := x.GetKey("a")
+	if err != nil || info == nil {
+		t.Fatalf("expected key [a] got %+v [%v]", info, err)
+	}
+}
+
+func TestCachedStoreFlushUsage(t *testing.T) {
+	backing := &countingStore{keys: map[KeyID]*KeyInfo{}}
+	x := Cached(backing, CacheOptions{})
+
+	err := x.FlushUsage()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = WithInvalidation(backing, x.Invalidate).FlushUsage()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if backing.flushes != 2 {
+		t.Fatalf("expected 2 flushes got [%d]", backing.flushes)
+	}
+}
@@ -1,22 +1,45 @@
 package dynamodb
 
 import (
+	"fmt"
+
 	"formation.engineering/oauth2-jwt/store"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
+// DeleteKey removes the key from its identity in the same transaction,
+// the identity is kept
 func (x *DynamoStore) DeleteKey(kid store.KeyID) error {
 	var err error
-	req := &dynamodb.DeleteItemInput{
-		TableName: aws.String(x.KeysTable),
-		Key: map[string]*dynamodb.AttributeValue{
-			"key_id": {
-				S: aws.String(kid),
-			},
+	info, err := x.GetKey(kid)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return nil
+	}
+
+	key := map[string]*dynamodb.AttributeValue{
+		"key_id": {
+			S: aws.String(kid),
 		},
 	}
 
-	_, err = x.Config.DeleteItem(req)
-	return err
+	req := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Delete: &dynamodb.Delete{TableName: aws.String(x.KeysTable), Key: key}},
+			{Update: x.updateIdentityKeys(info.IdentityID, "DELETE", kid)},
+		},
+	}
+
+	_, err = x.Config.TransactWriteItems(req)
+	if conditionsFailed(err)[1] {
+		// keys added before identities were stored have none
+		_, err = x.Config.DeleteItem(&dynamodb.DeleteItemInput{TableName: aws.String(x.KeysTable), Key: key})
+	}
+	if err != nil {
+		return fmt.Errorf("delete key [%s]: %v", kid, err)
+	}
+	return nil
 }
@@ -3,13 +3,37 @@ package dynamodb
 import (
 	"fmt"
 	"strconv"
+	"time"
 
+	"formation.engineering/oauth2-jwt/store"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 )
 
 func (x *DynamoStore) newIdentity() (*string, error) {
+	gen := x.Identities
+	if gen == nil {
+		gen = store.RandomIdentity{}
+	}
+
+	id, err := gen.NewIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// CounterIdentity is the sequential identity of stores before
+// RandomIdentity, kept in a single state table item. Every identity
+// writes the same item, avoid it for bulk key creation.
+type CounterIdentity struct {
+	StateTable string
+	Config     *dynamodb.DynamoDB
+}
+
+func (x CounterIdentity) NewIdentity() (store.IdentityID, error) {
 	input := &dynamodb.UpdateItemInput{
 		TableName:    aws.String(x.StateTable),
 		ReturnValues: aws.String("UPDATED_NEW"),
@@ -28,17 +52,237 @@ func (x *DynamoStore) newIdentity() (*string, error) {
 
 	res, err := x.Config.UpdateItem(input)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	hold := struct {
 		IdentityID int `dynamodbav:"identity_id"`
 	}{}
 	err = dynamodbattribute.UnmarshalMap(res.Attributes, &hold)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal map: %v", err)
+	}
+
+	return strconv.Itoa(hold.IdentityID), nil
+}
+
+type identityRecord struct {
+	IdentityID      string    `dynamodbav:"identity_id"`
+	TenantID        string    `dynamodbav:"tenant_id"`
+	TenantName      string    `dynamodbav:"tenant_name"`
+	ApplicationName string    `dynamodbav:"application_name"`
+	CreatedBy       string    `dynamodbav:"created_by"`
+	Created         time.Time `dynamodbav:"created"`
+	KeyIDs          []string  `dynamodbav:"key_ids,stringset,omitempty"`
+}
+
+func (x *DynamoStore) putIdentity(identity store.Identity) (*dynamodb.Put, error) {
+	r := identityRecord{
+		IdentityID:      identity.IdentityID,
+		TenantID:        identity.TenantID,
+		TenantName:      identity.TenantName,
+		ApplicationName: identity.ApplicationName,
+		CreatedBy:       identity.CreatedBy,
+		Created:         identity.Created,
+		KeyIDs:          identity.KeyIDs,
+	}
+
+	av, err := dynamodbattribute.MarshalMap(r)
+	if err != nil {
+		return nil, fmt.Errorf("marshal map: %v", err)
+	}
+
+	return &dynamodb.Put{
+		TableName:           aws.String(x.IdentitiesTable),
+		ConditionExpression: aws.String("attribute_not_exists(identity_id)"),
+		Item:                av,
+	}, nil
+}
+
+func (x *DynamoStore) GetIdentity(identityID store.IdentityID) (*store.Identity, error) {
+	req := dynamodb.GetItemInput{
+		TableName: aws.String(x.IdentitiesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			kIdentityID: {
+				S: aws.String(identityID),
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	getItem, err := x.Config.GetItem(&req)
+	if err != nil {
+		return nil, fmt.Errorf("get item: %v", err)
+	}
+
+	var hold identityRecord
+	err = dynamodbattribute.UnmarshalMap(getItem.Item, &hold)
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal map: %v", err)
 	}
 
-	out := strconv.Itoa(hold.IdentityID)
-	return &out, nil
+	if hold.IdentityID == "" {
+		return nil, nil
+	}
+
+	return &store.Identity{
+		IdentityID:      hold.IdentityID,
+		TenantID:        hold.TenantID,
+		TenantName:      hold.TenantName,
+		ApplicationName: hold.ApplicationName,
+		CreatedBy:       hold.CreatedBy,
+		Created:         hold.Created,
+		KeyIDs:          hold.KeyIDs,
+	}, nil
+}
+
+// AddIdentityKey writes the key and adds it to the identity in a single
+// transaction
+func (x *DynamoStore) AddIdentityKey(identityID store.IdentityID, kid store.KeyID, in store.AddKey) error {
+	identity, err := x.GetIdentity(identityID)
+	if err != nil {
+		return err
+	}
+	if identity == nil {
+		return fmt.Errorf("identity [%s]: %w", identityID, store.NotFound)
+	}
+
+	putKey, err := x.putKey(*identity, kid, in)
+	if err != nil {
+		return err
+	}
+
+	req := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: putKey},
+			{Update: x.updateIdentityKeys(identityID, "ADD", kid)},
+		},
+	}
+
+	_, err = x.Config.TransactWriteItems(req)
+	failed := conditionsFailed(err)
+	if failed[0] {
+		return fmt.Errorf("key [%s]: %w", kid, store.Conflict)
+	}
+	if failed[1] {
+		// deleted since read
+		return fmt.Errorf("identity [%s]: %w", identityID, store.NotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("transact write items: %v", err)
+	}
+
+	return nil
+}
+
+// updateIdentityKeys ADDs or DELETEs kid from the identity key_ids, a
+// missing identity is not recreated
+func (x *DynamoStore) updateIdentityKeys(identityID store.IdentityID, action string, kid store.KeyID) *dynamodb.Update {
+	return &dynamodb.Update{
+		TableName: aws.String(x.IdentitiesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			kIdentityID: {
+				S: aws.String(identityID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(identity_id)"),
+		UpdateExpression:    aws.String(action + " key_ids :k"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":k": {
+				SS: []*string{aws.String(kid)},
+			},
+		},
+	}
+}
+
+// MigrateIdentities creates the identities of keys added before
+// identities were stored, so they can be rotated with AddIdentityKey.
+// Existing identities keep their ID, numeric or not. It is idempotent,
+// returning the number of keys scanned.
+func (x *DynamoStore) MigrateIdentities() (int, error) {
+	proj := expression.NamesList(
+		expression.Name(iKeyID),
+		expression.Name(kIdentityID),
+		expression.Name(kTenantID),
+		expression.Name(kTenantName),
+		expression.Name(kApplicationName),
+		expression.Name(kCreatedBy),
+		expression.Name(kCreated),
+	)
+
+	expr, err := expression.NewBuilder().WithProjection(proj).Build()
+	if err != nil {
+		return 0, fmt.Errorf("builder: %v", err)
+	}
+
+	req := dynamodb.ScanInput{
+		TableName:                aws.String(x.KeysTable),
+		ProjectionExpression:     expr.Projection(),
+		ExpressionAttributeNames: expr.Names(),
+	}
+
+	count := 0
+	for {
+		res, err := x.Config.Scan(&req)
+		if err != nil {
+			return count, fmt.Errorf("scan: %v", err)
+		}
+
+		var items []keyMetadata
+		err = dynamodbattribute.UnmarshalListOfMaps(res.Items, &items)
+		if err != nil {
+			return count, fmt.Errorf("unmarshal list: %v", err)
+		}
+
+		for _, item := range items {
+			err = x.migrateIdentity(item)
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if len(res.LastEvaluatedKey) == 0 {
+			return count, nil
+		}
+		req.ExclusiveStartKey = res.LastEvaluatedKey
+	}
+}
+
+// migrateIdentity adds the key to its identity, creating the identity from
+// the key when missing
+func (x *DynamoStore) migrateIdentity(key keyMetadata) error {
+	created, err := dynamodbattribute.Marshal(key.Created)
+	if err != nil {
+		return fmt.Errorf("marshal created: %v", err)
+	}
+
+	req := &dynamodb.UpdateItemInput{
+		TableName: aws.String(x.IdentitiesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			kIdentityID: {
+				S: aws.String(key.IdentityID),
+			},
+		},
+		UpdateExpression: aws.String("SET tenant_id = if_not_exists(tenant_id, :t), " +
+			"tenant_name = if_not_exists(tenant_name, :n), " +
+			"application_name = if_not_exists(application_name, :a), " +
+			"created_by = if_not_exists(created_by, :c), " +
+			"created = if_not_exists(created, :d) " +
+			"ADD key_ids :k"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t": {S: aws.String(key.TenantID)},
+			":n": {S: aws.String(key.TenantName)},
+			":a": {S: aws.String(key.ApplicationName)},
+			":c": {S: aws.String(key.CreatedBy)},
+			":d": created,
+			":k": {SS: []*string{aws.String(key.KeyID)}},
+		},
+	}
+
+	_, err = x.Config.UpdateItem(req)
+	if err != nil {
+		return fmt.Errorf("update item [%s]: %v", key.IdentityID, err)
+	}
+	return nil
 }
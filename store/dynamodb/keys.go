@@ -1,6 +1,7 @@
 package dynamodb
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,7 +11,6 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
-	"github.com/pkg/errors"
 )
 
 type table struct {
@@ -22,6 +22,15 @@ type table struct {
 	IdentityID string            `dynamodbav:"identity_id"`
 	TenantID   string            `dynamodbav:"tenant_id"`
 	PublicKey  PublicKeyDynamodb `dynamodbav:"public_key"`
+	Scopes     []string          `dynamodbav:"scopes,stringset,omitempty"`
+	Policy     *keyPolicy        `dynamodbav:"policy,omitempty"`
+	Status     string            `dynamodbav:"status"`
+	ExpiresAt  *time.Time        `dynamodbav:"expires_at,omitempty"`
+
+	// Audit of the last status change
+	StatusChangedAt *time.Time `dynamodbav:"status_changed_at,omitempty"`
+	StatusChangedBy string     `dynamodbav:"status_changed_by,omitempty"`
+	StatusReason    string     `dynamodbav:"status_reason,omitempty"`
 
 	// UI Applicable
 	TenantName      string `dynamodbav:"tenant_name"`
@@ -34,6 +43,38 @@ type authorizationKeys struct {
 	IdentityID string            `dynamodbav:"identity_id"`
 	TenantID   string            `dynamodbav:"tenant_id"`
 	PublicKey  PublicKeyDynamodb `dynamodbav:"public_key"`
+	Scopes     []string          `dynamodbav:"scopes,stringset,omitempty"`
+	Policy     *keyPolicy        `dynamodbav:"policy,omitempty"`
+	Status     string            `dynamodbav:"status"`
+	ExpiresAt  *time.Time        `dynamodbav:"expires_at,omitempty"`
+}
+
+type keyPolicy struct {
+	MaxLifetime int64    `dynamodbav:"max_lifetime,omitempty"` // seconds
+	Audiences   []string `dynamodbav:"audiences,stringset,omitempty"`
+	Scopes      []string `dynamodbav:"scopes,stringset,omitempty"`
+}
+
+func fromKeyPolicy(p *store.KeyPolicy) *keyPolicy {
+	if p == nil {
+		return nil
+	}
+	return &keyPolicy{
+		MaxLifetime: int64(p.MaxLifetime.Seconds()),
+		Audiences:   p.Audiences,
+		Scopes:      p.Scopes,
+	}
+}
+
+func (x *keyPolicy) toKeyPolicy() *store.KeyPolicy {
+	if x == nil {
+		return nil
+	}
+	return &store.KeyPolicy{
+		MaxLifetime: time.Duration(x.MaxLifetime) * time.Second,
+		Audiences:   x.Audiences,
+		Scopes:      x.Scopes,
+	}
 }
 
 const (
@@ -41,25 +82,83 @@ const (
 	kPublicKey  = "public_key"
 	kTenantID   = "tenant_id"
 	kIdentityID = "identity_id"
+	kScopes     = "scopes"
+	kPolicy     = "policy"
+	kStatus     = "status"
+	kExpiresAt  = "expires_at"
+
+	kStatusChangedAt = "status_changed_at"
+	kStatusChangedBy = "status_changed_by"
+	kStatusReason    = "status_reason"
 )
 
-var Conflict = errors.New("conflict")
+// Conflict is store.Conflict, kept for callers matching it here
+var Conflict = store.Conflict
 
+// AddKey writes the key and its new identity in a single transaction,
+// neither is written on a conflict
 func (x *DynamoStore) AddKey(kid store.KeyID, in store.AddKey) (*store.IdentityID, error) {
-	identity, err := x.newIdentity()
+	id, err := x.newIdentity()
 	if err != nil {
 		return nil, fmt.Errorf("new identity: %v", err)
 	}
 
+	identity := store.Identity{
+		IdentityID:      *id,
+		TenantID:        in.TenantID,
+		TenantName:      in.TenantName,
+		ApplicationName: in.ApplicationName,
+		CreatedBy:       in.CreatedBy,
+		Created:         time.Now().UTC(),
+		KeyIDs:          []store.KeyID{kid},
+	}
+
+	putKey, err := x.putKey(identity, kid, in)
+	if err != nil {
+		return nil, err
+	}
+
+	putIdentity, err := x.putIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: putKey},
+			{Put: putIdentity},
+		},
+	}
+
+	_, err = x.Config.TransactWriteItems(req)
+	failed := conditionsFailed(err)
+	if failed[0] {
+		return nil, fmt.Errorf("key [%s]: %w", kid, store.Conflict)
+	}
+	if failed[1] {
+		return nil, fmt.Errorf("identity [%s]: %w", *id, store.Conflict)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("transact write items: %v", err)
+	}
+
+	return id, nil
+}
+
+func (x *DynamoStore) putKey(identity store.Identity, kid store.KeyID, in store.AddKey) (*dynamodb.Put, error) {
 	r := table{
 		Created:    time.Now().UTC(),
 		KeyID:      kid,
-		IdentityID: *identity,
-		TenantID:   in.TenantID,
+		IdentityID: identity.IdentityID,
+		TenantID:   identity.TenantID,
 		PublicKey:  PublicKeyDynamodb{in.PublicKey},
+		Scopes:     in.Scopes,
+		Policy:     fromKeyPolicy(in.Policy),
+		Status:     string(store.KeyActive),
+		ExpiresAt:  timeOrNil(in.ExpiresAt),
 
-		TenantName:      in.TenantName,
-		ApplicationName: in.ApplicationName,
+		TenantName:      identity.TenantName,
+		ApplicationName: identity.ApplicationName,
 		CreatedBy:       in.CreatedBy,
 	}
 
@@ -68,23 +167,27 @@ func (x *DynamoStore) AddKey(kid store.KeyID, in store.AddKey) (*store.IdentityI
 		return nil, fmt.Errorf("failed to DynamoDB marshal Record, %v", err)
 	}
 
-	req := &dynamodb.PutItemInput{
+	return &dynamodb.Put{
 		TableName:           aws.String(x.KeysTable),
 		ConditionExpression: aws.String("attribute_not_exists(key_id)"),
 		Item:                av,
-	}
+	}, nil
+}
 
-	_, err = x.Config.PutItem(req)
+// conditionsFailed reports, by item, whether a cancelled transaction
+// failed the item condition. Items past the reasons given are false.
+func conditionsFailed(err error) map[int]bool {
+	failed := make(map[int]bool)
 
-	if ConditionalCheckFailed(err) {
-		return nil, fmt.Errorf("offer already exists %s: %w", kid, Conflict)
+	var canceled *dynamodb.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return failed
 	}
 
-	if err != nil {
-		return nil, err
+	for i, reason := range canceled.CancellationReasons {
+		failed[i] = reason != nil && aws.StringValue(reason.Code) == "ConditionalCheckFailed"
 	}
-
-	return identity, nil
+	return failed
 }
 
 func ConditionalCheckFailed(err error) bool {
@@ -106,6 +209,10 @@ func getKey(client *dynamodb.DynamoDB, table string, kid store.KeyID) (*store.Ke
 		expression.Name(kPublicKey),
 		expression.Name(kIdentityID),
 		expression.Name(kTenantID),
+		expression.Name(kScopes),
+		expression.Name(kPolicy),
+		expression.Name(kStatus),
+		expression.Name(kExpiresAt),
 	)
 
 	expr, err := expression.NewBuilder().WithProjection(proj).Build()
@@ -145,7 +252,21 @@ func getKey(client *dynamodb.DynamoDB, table string, kid store.KeyID) (*store.Ke
 		PublicKey:  hold.PublicKey.Key,
 		IdentityID: hold.IdentityID,
 		TenantID:   hold.TenantID,
+		Scopes:     hold.Scopes,
+		Policy:     hold.Policy.toKeyPolicy(),
+		Status:     store.KeyStatus(hold.Status),
+	}
+	if hold.ExpiresAt != nil {
+		info.ExpiresAt = *hold.ExpiresAt
 	}
 
 	return &info, nil
 }
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,74 @@
+package dynamodb
+
+import (
+	"fmt"
+
+	"formation.engineering/oauth2-jwt/store"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// DefaultTenantIndex is the keys table GSI with partition key tenant_id
+// and sort key key_id
+const DefaultTenantIndex = "tenant_id-key_id-index"
+
+func (x *DynamoStore) ListKeys(tenantID string, page store.Page) (*store.KeyPage, error) {
+	keyCond := expression.Key(kTenantID).Equal(expression.Value(tenantID))
+	proj := expression.NamesList(
+		expression.Name(iKeyID),
+		expression.Name(kIdentityID),
+		expression.Name(kTenantID),
+		expression.Name(kApplicationName),
+		expression.Name(kCreatedBy),
+		expression.Name(kCreated),
+		expression.Name(kStatus),
+	)
+
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).WithProjection(proj).Build()
+	if err != nil {
+		return nil, fmt.Errorf("builder: %v", err)
+	}
+
+	req := dynamodb.QueryInput{
+		TableName:                 aws.String(x.KeysTable),
+		IndexName:                 aws.String(x.TenantIndex),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Limit:                     aws.Int64(int64(page.PageLimit())),
+	}
+
+	if page.Cursor != "" {
+		req.ExclusiveStartKey = map[string]*dynamodb.AttributeValue{
+			kTenantID: {S: aws.String(tenantID)},
+			iKeyID:    {S: aws.String(page.Cursor)},
+		}
+	}
+
+	res, err := x.Config.Query(&req)
+	if err != nil {
+		return nil, fmt.Errorf("query: %v", err)
+	}
+
+	var items []keyMetadata
+	err = dynamodbattribute.UnmarshalListOfMaps(res.Items, &items)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal list: %v", err)
+	}
+
+	out := store.KeyPage{Keys: make([]store.KeyMetadata, 0, len(items))}
+	for _, item := range items {
+		out.Keys = append(out.Keys, item.toKeyMetadata())
+	}
+
+	// the last page may still return a LastEvaluatedKey, the next page is
+	// then empty
+	if len(res.LastEvaluatedKey) > 0 && len(items) > 0 {
+		out.Next = items[len(items)-1].KeyID
+	}
+
+	return &out, nil
+}
@@ -0,0 +1,129 @@
+package dynamodb
+
+import (
+	"fmt"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+const (
+	kTenantName      = "tenant_name"
+	kApplicationName = "application_name"
+	kCreatedBy       = "created_by"
+	kCreated         = "created"
+	kLastUsed        = "last_used"
+)
+
+// keyMetadata is every attribute of the keys table but the public key
+type keyMetadata struct {
+	KeyID           string     `dynamodbav:"key_id"`
+	IdentityID      string     `dynamodbav:"identity_id"`
+	TenantID        string     `dynamodbav:"tenant_id"`
+	ApplicationName string     `dynamodbav:"application_name"`
+	CreatedBy       string     `dynamodbav:"created_by"`
+	Created         time.Time  `dynamodbav:"created"`
+	Status          string     `dynamodbav:"status"`
+	TenantName      string     `dynamodbav:"tenant_name"`
+	Scopes          []string   `dynamodbav:"scopes,stringset,omitempty"`
+	Policy          *keyPolicy `dynamodbav:"policy,omitempty"`
+	ExpiresAt       *time.Time `dynamodbav:"expires_at,omitempty"`
+	LastUsed        *time.Time `dynamodbav:"last_used,omitempty"`
+	UseCount        int64      `dynamodbav:"use_count,omitempty"`
+
+	StatusChangedAt *time.Time `dynamodbav:"status_changed_at,omitempty"`
+	StatusChangedBy string     `dynamodbav:"status_changed_by,omitempty"`
+	StatusReason    string     `dynamodbav:"status_reason,omitempty"`
+}
+
+func (x keyMetadata) toKeyMetadata() store.KeyMetadata {
+	status := store.KeyStatus(x.Status)
+	if status == "" {
+		status = store.KeyActive
+	}
+	return store.KeyMetadata{
+		KeyID:           x.KeyID,
+		IdentityID:      x.IdentityID,
+		TenantID:        x.TenantID,
+		ApplicationName: x.ApplicationName,
+		CreatedBy:       x.CreatedBy,
+		Created:         x.Created,
+		Status:          status,
+		TenantName:      x.TenantName,
+		Scopes:          x.Scopes,
+		Policy:          x.Policy.toKeyPolicy(),
+		ExpiresAt:       timeOrZero(x.ExpiresAt),
+		LastUsed:        timeOrZero(x.LastUsed),
+		UseCount:        x.UseCount,
+		StatusChangedAt: timeOrZero(x.StatusChangedAt),
+		StatusChangedBy: x.StatusChangedBy,
+		StatusReason:    x.StatusReason,
+	}
+}
+
+func (x *DynamoStore) GetKeyMetadata(kid store.KeyID) (*store.KeyMetadata, error) {
+	proj := expression.NamesList(
+		expression.Name(iKeyID),
+		expression.Name(kIdentityID),
+		expression.Name(kTenantID),
+		expression.Name(kApplicationName),
+		expression.Name(kCreatedBy),
+		expression.Name(kCreated),
+		expression.Name(kStatus),
+		expression.Name(kTenantName),
+		expression.Name(kScopes),
+		expression.Name(kPolicy),
+		expression.Name(kExpiresAt),
+		expression.Name(kLastUsed),
+		expression.Name(kUseCount),
+		expression.Name(kStatusChangedAt),
+		expression.Name(kStatusChangedBy),
+		expression.Name(kStatusReason),
+	)
+
+	expr, err := expression.NewBuilder().WithProjection(proj).Build()
+	if err != nil {
+		return nil, fmt.Errorf("builder: %v", err)
+	}
+
+	req := dynamodb.GetItemInput{
+		TableName: aws.String(x.KeysTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			iKeyID: {
+				S: aws.String(kid),
+			},
+		},
+		ProjectionExpression:     expr.Projection(),
+		ExpressionAttributeNames: expr.Names(),
+		ConsistentRead:           aws.Bool(true),
+	}
+
+	getItem, err := x.Config.GetItem(&req)
+	if err != nil {
+		return nil, fmt.Errorf("get item: %v", err)
+	}
+
+	var hold keyMetadata
+	err = dynamodbattribute.UnmarshalMap(getItem.Item, &hold)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal map: %v", err)
+	}
+
+	if hold.KeyID == "" {
+		return nil, nil
+	}
+
+	meta := hold.toKeyMetadata()
+	return &meta, nil
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
@@ -0,0 +1,72 @@
+package dynamodb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// DynamoReplayCache keeps assertion ids keyed by 'assertion_id', enable
+// a TTL on 'expires' so expired ids are removed.
+type DynamoReplayCache struct {
+	ReplayTable string
+	Config      *dynamodb.DynamoDB
+}
+
+type assertion struct {
+	AssertionID string `dynamodbav:"assertion_id"`
+	Expires     int64  `dynamodbav:"expires"`
+}
+
+const kAssertionID = "assertion_id"
+
+func NewReplayCache(region, replayTable string) *DynamoReplayCache {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	dyn := dynamodb.New(sess, &aws.Config{Region: aws.String(region)})
+	cache := DynamoReplayCache{ReplayTable: replayTable, Config: dyn}
+	return &cache
+}
+
+func (x *DynamoReplayCache) Seen(issuer, id string, expiry time.Time) (bool, error) {
+	av, err := dynamodbattribute.MarshalMap(assertion{
+		AssertionID: issuer + "#" + id,
+		Expires:     expiry.Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to DynamoDB marshal Record, %v", err)
+	}
+
+	// TTL deletes lag, so an expired id may be overwritten
+	cond := expression.AttributeNotExists(expression.Name(kAssertionID)).
+		Or(expression.Name(kExpires).LessThanEqual(expression.Value(time.Now().Unix())))
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return false, fmt.Errorf("builder: %v", err)
+	}
+
+	req := &dynamodb.PutItemInput{
+		TableName:                 aws.String(x.ReplayTable),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Item:                      av,
+	}
+
+	_, err = x.Config.PutItem(req)
+	if ConditionalCheckFailed(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("put item: %v", err)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,146 @@
+package dynamodb
+
+import (
+	"fmt"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// DefaultExpiryIndex is the revocations table GSI with partition key
+// bucket and sort key expires, ListRevoked queries it
+const DefaultExpiryIndex = "bucket-expires-index"
+
+// revokedBucket is the one 'bucket' of the expiry index, the unexpired
+// revocations are few enough for a single partition
+const revokedBucket = "revoked"
+
+// DynamoRevocationStore keeps revocations keyed by 'token_id', enable a
+// TTL on 'expires' so expired revocations are removed.
+type DynamoRevocationStore struct {
+	RevocationsTable string
+	ExpiryIndex      string
+	Config           *dynamodb.DynamoDB
+}
+
+type revocation struct {
+	TokenID  string `dynamodbav:"token_id"`
+	TenantID string `dynamodbav:"tenant_id"`
+	Bucket   string `dynamodbav:"bucket"`
+	Expires  int64  `dynamodbav:"expires"`
+}
+
+const (
+	kTokenID = "token_id"
+	kBucket  = "bucket"
+	kExpires = "expires"
+)
+
+func NewRevocationStore(region, revocationsTable string) *DynamoRevocationStore {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	dyn := dynamodb.New(sess, &aws.Config{Region: aws.String(region)})
+	store := DynamoRevocationStore{RevocationsTable: revocationsTable, ExpiryIndex: DefaultExpiryIndex, Config: dyn}
+	return &store
+}
+
+func (x *DynamoRevocationStore) Revoke(r store.Revocation) error {
+	av, err := dynamodbattribute.MarshalMap(revocation{
+		TokenID:  r.TokenID,
+		TenantID: r.TenantID,
+		Bucket:   revokedBucket,
+		Expires:  r.Expiry.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to DynamoDB marshal Record, %v", err)
+	}
+
+	_, err = x.Config.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(x.RevocationsTable),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("put item: %v", err)
+	}
+
+	return nil
+}
+
+func (x *DynamoRevocationStore) Revoked(tokenID string, now time.Time) (bool, error) {
+	// consistent, so a token is inactive as soon as Revoke returns
+	res, err := x.Config.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(x.RevocationsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			kTokenID: {S: aws.String(tokenID)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, fmt.Errorf("get item: %v", err)
+	}
+	if len(res.Item) == 0 {
+		return false, nil
+	}
+
+	var item revocation
+	err = dynamodbattribute.UnmarshalMap(res.Item, &item)
+	if err != nil {
+		return false, fmt.Errorf("unmarshal: %v", err)
+	}
+
+	// TTL deletes lag
+	return item.Expires > now.Unix(), nil
+}
+
+func (x *DynamoRevocationStore) ListRevoked(now time.Time) ([]store.Revocation, error) {
+	// only the unexpired revocations are read, expired items are left to
+	// the TTL
+	keyCond := expression.Key(kBucket).Equal(expression.Value(revokedBucket)).
+		And(expression.Key(kExpires).GreaterThan(expression.Value(now.Unix())))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("builder: %v", err)
+	}
+
+	req := dynamodb.QueryInput{
+		TableName:                 aws.String(x.RevocationsTable),
+		IndexName:                 aws.String(x.ExpiryIndex),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	var out []store.Revocation
+	for {
+		res, err := x.Config.Query(&req)
+		if err != nil {
+			return nil, fmt.Errorf("query: %v", err)
+		}
+
+		var items []revocation
+		err = dynamodbattribute.UnmarshalListOfMaps(res.Items, &items)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal list: %v", err)
+		}
+
+		for _, item := range items {
+			out = append(out, store.Revocation{
+				TokenID:  item.TokenID,
+				TenantID: item.TenantID,
+				Expiry:   time.Unix(item.Expires, 0),
+			})
+		}
+
+		if len(res.LastEvaluatedKey) == 0 {
+			return out, nil
+		}
+		req.ExclusiveStartKey = res.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,62 @@
+package dynamodb
+
+import (
+	"fmt"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+func (x *DynamoStore) SetKeyStatus(kid store.KeyID, change store.StatusChange) error {
+	if !change.Status.Valid() {
+		return fmt.Errorf("invalid status [%s]", change.Status)
+	}
+
+	update := expression.Set(expression.Name(kStatus), expression.Value(string(change.Status))).
+		Set(expression.Name(kStatusChangedAt), expression.Value(time.Now().UTC())).
+		Set(expression.Name(kStatusChangedBy), expression.Value(change.ChangedBy)).
+		Set(expression.Name(kStatusReason), expression.Value(change.Reason))
+
+	notRevoked := expression.AttributeNotExists(expression.Name(kStatus)).
+		Or(expression.Name(kStatus).NotEqual(expression.Value(string(store.KeyRevoked))))
+	cond := expression.AttributeExists(expression.Name(iKeyID)).And(notRevoked)
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(cond).Build()
+	if err != nil {
+		return fmt.Errorf("builder: %v", err)
+	}
+
+	req := &dynamodb.UpdateItemInput{
+		TableName: aws.String(x.KeysTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			iKeyID: {
+				S: aws.String(kid),
+			},
+		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	_, err = x.Config.UpdateItem(req)
+	if ConditionalCheckFailed(err) {
+		// missing or revoked, the condition does not say which
+		info, gerr := x.GetKey(kid)
+		if gerr != nil {
+			return gerr
+		}
+		if info == nil {
+			return fmt.Errorf("key [%s]: %w", kid, store.NotFound)
+		}
+		return fmt.Errorf("key [%s]: %w", kid, store.AlreadyRevoked)
+	}
+	if err != nil {
+		return fmt.Errorf("update item: %v", err)
+	}
+
+	return nil
+}
@@ -1,34 +1,48 @@
 package dynamodb
 
 import (
+	"formation.engineering/oauth2-jwt/store"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 type DynamoStore struct {
-	StateTable string
-	KeysTable  string
-	Config     *dynamodb.DynamoDB
+	KeysTable       string
+	IdentitiesTable string
+	// TenantIndex of KeysTable, defaults to DefaultTenantIndex
+	TenantIndex string
+	// Identities defaults to store.RandomIdentity
+	Identities store.IdentityGenerator
+	// Usage throttles KeyUsed writes
+	Usage  store.UsageThrottle
+	Config *dynamodb.DynamoDB
 }
 
-func NewStore(region, stateTable, keysTable string) *DynamoStore {
+func NewStore(region, keysTable, identitiesTable string) *DynamoStore {
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
 	}))
 
-	return NewStoreWithSession(sess, region, stateTable, keysTable)
+	return NewStoreWithSession(sess, region, keysTable, identitiesTable)
 }
 
-func NewStoreWithSession(sess *session.Session, region, stateTable, keysTable string) *DynamoStore {
+func NewStoreWithSession(sess *session.Session, region, keysTable, identitiesTable string) *DynamoStore {
 	dyn := dynamodb.New(sess, &aws.Config{Region: aws.String(region)})
-	store := DynamoStore{StateTable: stateTable, KeysTable: keysTable, Config: dyn}
+	store := DynamoStore{
+		KeysTable:       keysTable,
+		IdentitiesTable: identitiesTable,
+		TenantIndex:     DefaultTenantIndex,
+		Config:          dyn,
+	}
 	return &store
 }
 
 type DynamoReadOnlyStore struct {
 	KeysTable string
-	Config    *dynamodb.DynamoDB
+	// Usage throttles KeyUsed writes
+	Usage  store.UsageThrottle
+	Config *dynamodb.DynamoDB
 }
 
 func NewReadOnlyStore(region, keysTable string) *DynamoReadOnlyStore {
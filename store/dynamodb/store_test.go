@@ -8,16 +8,20 @@ import (
 )
 
 const (
-	region     = "us-west-2"
-	stateTable = "ci-test-state"
-	keysTable  = "ci-test-gator-keys"
+	region          = "us-west-2"
+	stateTable      = "ci-test-state"
+	keysTable       = "ci-test-gator-keys"
+	identitiesTable = "ci-test-gator-identities"
+
+	revocationsTable = "ci-test-gator-revocations"
+	replayTable      = "ci-test-gator-assertions"
 )
 
 func TestIdentity(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping dynamo test")
 	}
-	store := NewStore(region, stateTable, keysTable)
+	store := NewStore(region, keysTable, identitiesTable)
 	r0, err := store.newIdentity()
 	if err != nil {
 		t.Fatal(err.Error())
@@ -30,12 +34,43 @@ func TestIdentity(t *testing.T) {
 		t.Fatalf("Identities match [%s:%s]", *r0, *r1)
 	}
 
+	counter := CounterIdentity{StateTable: stateTable, Config: store.Config}
+	c0, err := counter.NewIdentity()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c1, err := counter.NewIdentity()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if c0 == c1 {
+		t.Fatalf("Identities match [%s:%s]", c0, c1)
+	}
 }
 
 func TestDynamoStore(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping dynamo test")
 	}
-	store := NewStore(region, stateTable, keysTable)
+	store := NewStore(region, keysTable, identitiesTable)
 	x.TestStore(t, store)
+	x.TestListKeys(t, store)
+	x.TestKeyUsage(t, store)
+	x.TestIdentityKeys(t, store)
+}
+
+func TestDynamoRevocationStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping dynamo test")
+	}
+	store := NewRevocationStore(region, revocationsTable)
+	x.TestRevocationStore(t, store)
+}
+
+func TestDynamoReplayCache(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping dynamo test")
+	}
+	cache := NewReplayCache(region, replayTable)
+	x.TestReplayCache(t, cache)
 }
@@ -0,0 +1,97 @@
+package dynamodb
+
+import (
+	"fmt"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+const kUseCount = "use_count"
+
+// KeyUsed writes at most once per key per Usage.Interval, uses in
+// between are counted and written with the next write
+func (x *DynamoStore) KeyUsed(kid store.KeyID, at time.Time) error {
+	return keyUsed(x.Config, x.KeysTable, &x.Usage, kid, at)
+}
+
+// FlushUsage writes usage held back by the throttle, call on shutdown
+func (x *DynamoStore) FlushUsage() error {
+	return flushUsage(x.Config, x.KeysTable, &x.Usage)
+}
+
+// KeyUsed writes at most once per key per Usage.Interval, uses in
+// between are counted and written with the next write
+func (x *DynamoReadOnlyStore) KeyUsed(kid store.KeyID, at time.Time) error {
+	return keyUsed(x.Config, x.KeysTable, &x.Usage, kid, at)
+}
+
+// FlushUsage writes usage held back by the throttle, call on shutdown
+func (x *DynamoReadOnlyStore) FlushUsage() error {
+	return flushUsage(x.Config, x.KeysTable, &x.Usage)
+}
+
+func keyUsed(db *dynamodb.DynamoDB, keysTable string, throttle *store.UsageThrottle, kid store.KeyID, at time.Time) error {
+	usage, due := throttle.Add(kid, at)
+	if !due {
+		return nil
+	}
+
+	err := writeUsage(db, keysTable, kid, usage)
+	if err != nil {
+		throttle.Restore(kid, usage)
+		return err
+	}
+	return nil
+}
+
+func flushUsage(db *dynamodb.DynamoDB, keysTable string, throttle *store.UsageThrottle) error {
+	var failed error
+	for kid, usage := range throttle.Drain() {
+		err := writeUsage(db, keysTable, kid, usage)
+		if err != nil {
+			throttle.Restore(kid, usage)
+			failed = err
+		}
+	}
+	return failed
+}
+
+func writeUsage(db *dynamodb.DynamoDB, keysTable string, kid store.KeyID, usage store.Usage) error {
+	update := expression.Add(expression.Name(kUseCount), expression.Value(usage.Count)).
+		Set(expression.Name(kLastUsed), expression.Value(usage.LastUsed.UTC()))
+
+	// a deleted key must not be recreated by a late write
+	cond := expression.AttributeExists(expression.Name(iKeyID))
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(cond).Build()
+	if err != nil {
+		return fmt.Errorf("builder: %v", err)
+	}
+
+	req := &dynamodb.UpdateItemInput{
+		TableName: aws.String(keysTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			iKeyID: {
+				S: aws.String(kid),
+			},
+		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+
+	_, err = db.UpdateItem(req)
+	if ConditionalCheckFailed(err) {
+		return fmt.Errorf("key [%s]: %w", kid, store.NotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("update item: %v", err)
+	}
+
+	return nil
+}
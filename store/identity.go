@@ -0,0 +1,29 @@
+package store
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// IdentityGenerator mints the IdentityID of a new identity. IDs are
+// opaque, numeric IDs of existing identities stay valid alongside
+// generated ones.
+type IdentityGenerator interface {
+	NewIdentity() (IdentityID, error)
+}
+
+// RandomIdentity generates random (version 4) UUIDs, the default
+type RandomIdentity struct{}
+
+func (RandomIdentity) NewIdentity() (IdentityID, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", fmt.Errorf("random identity: %w", err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
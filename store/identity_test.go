@@ -0,0 +1,25 @@
+package store
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRandomIdentity(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	r0, err := RandomIdentity{}.NewIdentity()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r1, err := RandomIdentity{}.NewIdentity()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if r0 == r1 {
+		t.Fatalf("Identities match [%s:%s]", r0, r1)
+	}
+	if !uuid.MatchString(r0) {
+		t.Fatalf("expected a version 4 uuid got [%s]", r0)
+	}
+}
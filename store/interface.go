@@ -1,6 +1,10 @@
 package store
 
-import "crypto"
+import (
+	"crypto"
+	"errors"
+	"time"
+)
 
 type Key = crypto.PublicKey
 
@@ -8,10 +12,41 @@ type KeyID = string
 
 type IdentityID = string
 
+var (
+	NotFound = errors.New("not found")
+
+	// AlreadyRevoked is returned changing the status of a revoked key
+	AlreadyRevoked = errors.New("key already revoked")
+
+	// Conflict is returned adding a key, or identity, that already exists.
+	// Nothing is written.
+	Conflict = errors.New("conflict")
+)
+
 type Store interface {
+	// AddKey creates a new identity owning the key
 	AddKey(keyid KeyID, info AddKey) (*IdentityID, error)
 	GetKey(keyid KeyID) (*KeyInfo, error)
 
+	// AddIdentityKey adds a key to an existing identity, so a client can
+	// rotate keys keeping its 'iss'. The tenant and application are those
+	// of the identity, NotFound if it is missing.
+	AddIdentityKey(identityID IdentityID, keyid KeyID, info AddKey) error
+
+	// GetIdentity is nil if missing
+	GetIdentity(identityID IdentityID) (*Identity, error)
+
+	// SetKeyStatus disables, enables or revokes a key, the key record is
+	// kept for audit. Revoking is final.
+	SetKeyStatus(keyid KeyID, change StatusChange) error
+
+	// GetKeyMetadata is everything stored about a key but the key
+	// material, nil if missing
+	GetKeyMetadata(keyid KeyID) (*KeyMetadata, error)
+
+	// ListKeys of a tenant ordered by KeyID, metadata only
+	ListKeys(tenantID string, page Page) (*KeyPage, error)
+
 	// For Testing
 	DeleteKey(keyid KeyID) error
 }
@@ -27,10 +62,147 @@ type AddKey struct {
 	TenantName      string
 	ApplicationName string
 	CreatedBy       string
+	// Scopes the key may request, beyond the tenant scope
+	Scopes []string
+	// Policy limiting the tokens granted to the key, optional
+	Policy *KeyPolicy
+	// ExpiresAt the key is no longer accepted, zero never expires
+	ExpiresAt time.Time
+}
+
+// Identity is the 'iss' of the assertions signed by any of its keys
+type Identity struct {
+	IdentityID      IdentityID
+	TenantID        string
+	TenantName      string
+	ApplicationName string
+	CreatedBy       string
+	Created         time.Time
+	// KeyIDs owned by the identity, in any status
+	KeyIDs []KeyID
 }
 
 type KeyInfo struct {
 	PublicKey  Key
 	IdentityID string
 	TenantID   string
+	Scopes     []string
+	Policy     *KeyPolicy
+	// Status is empty for keys added before it existed, see Active
+	Status    KeyStatus
+	ExpiresAt time.Time
+}
+
+// Active reports whether the key is enabled and unexpired at now
+func (x KeyInfo) Active(now time.Time) bool {
+	return (x.Status == "" || x.Status == KeyActive) && (x.ExpiresAt.IsZero() || now.Before(x.ExpiresAt))
+}
+
+// KeyMetadata describes a key, it never holds key material. ListKeys
+// only fills KeyID through Status.
+type KeyMetadata struct {
+	KeyID           KeyID
+	IdentityID      IdentityID
+	TenantID        string
+	ApplicationName string
+	CreatedBy       string
+	Created         time.Time
+	Status          KeyStatus
+
+	TenantName string
+	Scopes     []string
+	Policy     *KeyPolicy
+	ExpiresAt  time.Time
+	// LastUsed and UseCount are zero if the key was never used, or usage
+	// isn't tracked, see UsageRecorder. LastUsed lags by up to the throttle
+	// interval of the store. UseCount lags the same, and undercounts the
+	// uses held back by a process that stopped without FlushUsage, see
+	// UsageFlusher.
+	LastUsed time.Time
+	UseCount int64
+
+	// Audit of the last status change, zero if never changed
+	StatusChangedAt time.Time
+	StatusChangedBy string
+	StatusReason    string
+}
+
+// DefaultPageLimit of keys listed when Page.Limit is 0
+const DefaultPageLimit = 100
+
+type Page struct {
+	Limit int
+	// Cursor is KeyPage.Next of the previous page, empty for the first
+	Cursor string
+}
+
+func (x Page) PageLimit() int {
+	if x.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	return x.Limit
+}
+
+type KeyPage struct {
+	Keys []KeyMetadata
+	// Next page cursor, empty on the last page
+	Next string
+}
+
+type KeyStatus string
+
+const (
+	KeyActive   KeyStatus = "active"
+	KeyDisabled KeyStatus = "disabled"
+	KeyRevoked  KeyStatus = "revoked"
+)
+
+func (x KeyStatus) Valid() bool {
+	return x == KeyActive || x == KeyDisabled || x == KeyRevoked
+}
+
+type StatusChange struct {
+	Status KeyStatus
+	// ChangedBy and Reason are kept for audit
+	ChangedBy string
+	Reason    string
+}
+
+// KeyPolicy limits the tokens granted to a key, zero values are
+// unrestricted.
+type KeyPolicy struct {
+	// MaxLifetime of granted tokens, replaces the server maximum so it
+	// may be longer or shorter
+	MaxLifetime time.Duration
+	// Audiences the key may address assertions to, a subset of those the
+	// server accepts
+	Audiences []string
+	// Scopes the key may be granted, intersected with KeyInfo.Scopes so a
+	// tenant policy can narrow the scopes of every key of the tenant
+	Scopes []string
+}
+
+// RevocationStore holds revoked tokens until they expire
+type RevocationStore interface {
+	Revoke(r Revocation) error
+
+	// Revoked reports whether the token is revoked and unexpired at now
+	Revoked(tokenID string, now time.Time) (bool, error)
+
+	// ListRevoked returns the revocations of tokens unexpired at now
+	ListRevoked(now time.Time) ([]Revocation, error)
+}
+
+type Revocation struct {
+	TokenID  string
+	TenantID string
+	Expiry   time.Time
+}
+
+// ReplayCache remembers assertion ids until the assertion is no longer
+// accepted, its 'exp' plus any clock skew
+// https://tools.ietf.org/html/rfc7523#section-3
+type ReplayCache interface {
+	// Seen records (issuer, id), reporting whether it was already recorded
+	Seen(issuer, id string, expiry time.Time) (bool, error)
 }
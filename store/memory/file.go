@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"formation.engineering/oauth2-jwt/store"
+	"github.com/pkg/errors"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// NewFileStore is a MemoryStore persisted to a JSON file at path, for
+// local servers that keep their keys across restarts. The file is loaded
+// if it exists and rewritten on every change.
+func NewFileStore(path string) (*MemoryStore, error) {
+	x := NewMemoryStore()
+	x.path = path
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return x, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "read store")
+	}
+
+	var state fileState
+	err = json.Unmarshal(raw, &state)
+	if err != nil {
+		return nil, errors.WithMessage(err, "decode store")
+	}
+
+	for _, k := range state.Keys {
+		k.Info.PublicKey = k.PublicKey
+		x.db[k.Meta.KeyID] = &record{info: k.Info, meta: k.Meta}
+	}
+	for i := range state.Identities {
+		identity := state.Identities[i]
+		x.identities[identity.IdentityID] = &identity
+	}
+
+	return x, nil
+}
+
+type fileState struct {
+	Keys       []fileKey        `json:"keys"`
+	Identities []store.Identity `json:"identities"`
+}
+
+// fileKey holds the public key as a JWK, the KeyInfo key is left empty
+type fileKey struct {
+	PublicKey jose.JSONWebKey   `json:"public_key"`
+	Info      store.KeyInfo     `json:"info"`
+	Meta      store.KeyMetadata `json:"meta"`
+}
+
+// save requires the lock, it is a no-op unless persisted. The state with
+// u applied is written to a temporary file, synced and renamed over the
+// file, then the directory is synced so the rename survives a crash.
+func (x *MemoryStore) save(u update) error {
+	if x.path == "" {
+		return nil
+	}
+
+	db := make(map[store.KeyID]*record, len(x.db)+len(u.keys))
+	for kid, res := range x.db {
+		db[kid] = res
+	}
+	for kid, res := range u.keys {
+		if res == nil {
+			delete(db, kid)
+			continue
+		}
+		db[kid] = res
+	}
+	identities := make(map[store.IdentityID]*store.Identity, len(x.identities)+len(u.identities))
+	for id, identity := range x.identities {
+		identities[id] = identity
+	}
+	for id, identity := range u.identities {
+		identities[id] = identity
+	}
+
+	state := fileState{
+		Keys:       make([]fileKey, 0, len(db)),
+		Identities: make([]store.Identity, 0, len(identities)),
+	}
+	for _, res := range db {
+		pub, ok := res.info.PublicKey.(jose.JSONWebKey)
+		if !ok {
+			pub = jose.JSONWebKey{Key: res.info.PublicKey}
+		}
+		info := res.info
+		info.PublicKey = nil
+		state.Keys = append(state.Keys, fileKey{PublicKey: pub, Info: info, Meta: res.meta})
+	}
+	for _, identity := range identities {
+		state.Identities = append(state.Identities, *identity)
+	}
+
+	raw, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.WithMessage(err, "encode store")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(x.path), filepath.Base(x.path)+".*")
+	if err != nil {
+		return errors.WithMessage(err, "write store")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(raw)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.WithMessage(err, "write store")
+	}
+
+	err = os.Rename(tmp.Name(), x.path)
+	if err != nil {
+		return fmt.Errorf("replace store [%s]: %w", x.path, err)
+	}
+
+	dir, err := os.Open(filepath.Dir(x.path))
+	if err != nil {
+		return errors.WithMessage(err, "sync store")
+	}
+	err = dir.Sync()
+	if cerr := dir.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.WithMessage(err, "sync store")
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneInterval between sweeps of expired assertion ids
+const pruneInterval = time.Minute
+
+type MemoryReplayCache struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+func NewReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{
+		now:  time.Now,
+		seen: make(map[string]time.Time),
+	}
+}
+
+func (x *MemoryReplayCache) Seen(issuer, id string, expiry time.Time) (bool, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	now := x.now()
+	if now.Sub(x.pruned) > pruneInterval {
+		for k, exp := range x.seen {
+			if !exp.After(now) {
+				delete(x.seen, k)
+			}
+		}
+		x.pruned = now
+	}
+
+	key := issuer + "#" + id
+	if exp, ok := x.seen[key]; ok && exp.After(now) {
+		return true, nil
+	}
+
+	x.seen[key] = expiry
+	return false, nil
+}
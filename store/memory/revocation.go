@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+)
+
+type MemoryRevocationStore struct {
+	mu      sync.Mutex
+	revoked map[string]store.Revocation
+}
+
+func NewRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked: make(map[string]store.Revocation),
+	}
+}
+
+func (x *MemoryRevocationStore) Revoke(r store.Revocation) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.revoked[r.TokenID] = r
+	return nil
+}
+
+func (x *MemoryRevocationStore) Revoked(tokenID string, now time.Time) (bool, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	r, ok := x.revoked[tokenID]
+	return ok && r.Expiry.After(now), nil
+}
+
+func (x *MemoryRevocationStore) ListRevoked(now time.Time) ([]store.Revocation, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	out := make([]store.Revocation, 0, len(x.revoked))
+	for id, r := range x.revoked {
+		if !r.Expiry.After(now) {
+			delete(x.revoked, id)
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
@@ -2,66 +2,311 @@ package memory
 
 import (
 	"fmt"
-	"strconv"
+	"sort"
+	"sync"
+	"time"
 
 	"formation.engineering/oauth2-jwt/store"
 	"github.com/pkg/errors"
 )
 
+// MemoryStore is safe for concurrent use. It is persisted to a JSON file
+// when created with NewFileStore.
 type MemoryStore struct {
-	identity int
-	db       map[store.KeyID]*store.KeyInfo
+	// Identities defaults to store.RandomIdentity
+	Identities store.IdentityGenerator
+
+	// path is empty when not persisted
+	path string
+
+	mu         sync.RWMutex
+	db         map[store.KeyID]*record
+	identities map[store.IdentityID]*store.Identity
+}
+
+type record struct {
+	info store.KeyInfo
+	meta store.KeyMetadata
 }
 
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		identity: 0,
-		db:       make(map[store.KeyID]*store.KeyInfo),
+		db:         make(map[store.KeyID]*record),
+		identities: make(map[store.IdentityID]*store.Identity),
 	}
 }
 
-func (x *MemoryStore) newIdentity() string {
-	x.identity++
-	return strconv.Itoa(x.identity)
+func (x *MemoryStore) newIdentity() (store.IdentityID, error) {
+	if x.Identities == nil {
+		return store.RandomIdentity{}.NewIdentity()
+	}
+	return x.Identities.NewIdentity()
 }
 
+// initialize requires the write lock
 func (x *MemoryStore) initialize() {
 	if x.db == nil {
-		x.db = make(map[store.KeyID]*store.KeyInfo)
+		x.db = make(map[store.KeyID]*record)
+	}
+	if x.identities == nil {
+		x.identities = make(map[store.IdentityID]*store.Identity)
 	}
 }
 
 func (x *MemoryStore) AddKey(keyid store.KeyID, in store.AddKey) (*store.IdentityID, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
 	x.initialize()
 
-	identity := x.newIdentity()
+	// before minting an identity that would be dropped
+	if _, ok := x.db[keyid]; ok {
+		return nil, fmt.Errorf("key [%s]: %w", keyid, store.Conflict)
+	}
 
-	tmp, err := x.GetKey(keyid)
+	identityID, err := x.newIdentity()
 	if err != nil {
-		return nil, errors.WithMessage(err, "add-key")
+		return nil, errors.WithMessage(err, "new identity")
 	}
-	if tmp != nil {
-		return nil, fmt.Errorf("conflict - existing KeyID [%s]", keyid)
+
+	if _, ok := x.identities[identityID]; ok {
+		return nil, fmt.Errorf("identity [%s]: %w", identityID, store.Conflict)
 	}
 
-	x.db[keyid] = &store.KeyInfo{
-		PublicKey:  in.PublicKey,
-		IdentityID: identity,
-		TenantID:   in.TenantID,
+	identity := store.Identity{
+		IdentityID:      identityID,
+		TenantID:        in.TenantID,
+		TenantName:      in.TenantName,
+		ApplicationName: in.ApplicationName,
+		CreatedBy:       in.CreatedBy,
+		Created:         time.Now().UTC(),
+		KeyIDs:          []store.KeyID{keyid},
+	}
+
+	err = x.apply(update{
+		keys:       map[store.KeyID]*record{keyid: newRecord(&identity, keyid, in)},
+		identities: map[store.IdentityID]*store.Identity{identityID: &identity},
+	})
+	if err != nil {
+		return nil, err
 	}
-	return &identity, nil
+
+	return &identity.IdentityID, nil
 }
 
-func (x *MemoryStore) GetKey(keyid store.KeyID) (*store.KeyInfo, error) {
+func (x *MemoryStore) AddIdentityKey(identityID store.IdentityID, keyid store.KeyID, in store.AddKey) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
 	x.initialize()
+
+	identity, ok := x.identities[identityID]
+	if !ok {
+		return fmt.Errorf("identity [%s]: %w", identityID, store.NotFound)
+	}
+	if _, ok := x.db[keyid]; ok {
+		return fmt.Errorf("key [%s]: %w", keyid, store.Conflict)
+	}
+
+	updated := *identity
+	updated.KeyIDs = append(append([]store.KeyID(nil), identity.KeyIDs...), keyid)
+
+	return x.apply(update{
+		keys:       map[store.KeyID]*record{keyid: newRecord(&updated, keyid, in)},
+		identities: map[store.IdentityID]*store.Identity{identityID: &updated},
+	})
+}
+
+// newRecord of a key added to identity
+func newRecord(identity *store.Identity, keyid store.KeyID, in store.AddKey) *record {
+	return &record{
+		info: store.KeyInfo{
+			PublicKey:  in.PublicKey,
+			IdentityID: identity.IdentityID,
+			TenantID:   identity.TenantID,
+			Scopes:     in.Scopes,
+			Policy:     in.Policy,
+			Status:     store.KeyActive,
+			ExpiresAt:  in.ExpiresAt,
+		},
+		meta: store.KeyMetadata{
+			KeyID:           keyid,
+			IdentityID:      identity.IdentityID,
+			TenantID:        identity.TenantID,
+			ApplicationName: identity.ApplicationName,
+			CreatedBy:       in.CreatedBy,
+			Created:         time.Now().UTC(),
+			Status:          store.KeyActive,
+			TenantName:      identity.TenantName,
+			Scopes:          in.Scopes,
+			Policy:          in.Policy,
+			ExpiresAt:       in.ExpiresAt,
+		},
+	}
+}
+
+func (x *MemoryStore) GetIdentity(identityID store.IdentityID) (*store.Identity, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	identity, ok := x.identities[identityID]
+	if !ok {
+		return nil, nil
+	}
+	out := *identity
+	out.KeyIDs = append([]store.KeyID(nil), identity.KeyIDs...)
+	return &out, nil
+}
+
+func (x *MemoryStore) GetKey(keyid store.KeyID) (*store.KeyInfo, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
 	res, ok := x.db[keyid]
 	if !ok {
 		return nil, nil
 	}
-	return res, nil
+	info := res.info
+	return &info, nil
+}
+
+func (x *MemoryStore) SetKeyStatus(keyid store.KeyID, change store.StatusChange) error {
+	if !change.Status.Valid() {
+		return fmt.Errorf("invalid status [%s]", change.Status)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	res, ok := x.db[keyid]
+	if !ok {
+		return fmt.Errorf("key [%s]: %w", keyid, store.NotFound)
+	}
+	if res.info.Status == store.KeyRevoked {
+		return fmt.Errorf("key [%s]: %w", keyid, store.AlreadyRevoked)
+	}
+
+	updated := *res
+	updated.info.Status = change.Status
+	updated.meta.Status = change.Status
+	updated.meta.StatusChangedAt = time.Now().UTC()
+	updated.meta.StatusChangedBy = change.ChangedBy
+	updated.meta.StatusReason = change.Reason
+	return x.apply(keyUpdate(keyid, &updated))
+}
+
+// KeyUsed is written immediately, memory writes are cheap. It is not
+// persisted until the next change to the store.
+func (x *MemoryStore) KeyUsed(keyid store.KeyID, at time.Time) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	res, ok := x.db[keyid]
+	if !ok {
+		return fmt.Errorf("key [%s]: %w", keyid, store.NotFound)
+	}
+	res.meta.UseCount++
+	if at.After(res.meta.LastUsed) {
+		res.meta.LastUsed = at.UTC()
+	}
+	return nil
+}
+
+func (x *MemoryStore) GetKeyMetadata(keyid store.KeyID) (*store.KeyMetadata, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	res, ok := x.db[keyid]
+	if !ok {
+		return nil, nil
+	}
+	meta := res.meta
+	return &meta, nil
+}
+
+func (x *MemoryStore) ListKeys(tenantID string, page store.Page) (*store.KeyPage, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	var keys []store.KeyMetadata
+	for kid, res := range x.db {
+		if res.meta.TenantID == tenantID && kid > page.Cursor {
+			keys = append(keys, listed(res.meta))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+
+	out := store.KeyPage{Keys: keys}
+	if limit := page.PageLimit(); len(keys) > limit {
+		out.Keys = keys[:limit]
+		out.Next = keys[limit-1].KeyID
+	}
+	return &out, nil
+}
+
+// listed is the metadata returned by ListKeys
+func listed(meta store.KeyMetadata) store.KeyMetadata {
+	return store.KeyMetadata{
+		KeyID:           meta.KeyID,
+		IdentityID:      meta.IdentityID,
+		TenantID:        meta.TenantID,
+		ApplicationName: meta.ApplicationName,
+		CreatedBy:       meta.CreatedBy,
+		Created:         meta.Created,
+		Status:          meta.Status,
+	}
 }
 
 func (x *MemoryStore) DeleteKey(keyid store.KeyID) error {
-	delete(x.db, keyid)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	res, ok := x.db[keyid]
+	if !ok {
+		return nil
+	}
+	u := keyUpdate(keyid, nil)
+
+	// the identity is kept, keys may be added to it again
+	if identity, ok := x.identities[res.info.IdentityID]; ok {
+		updated := *identity
+		updated.KeyIDs = make([]store.KeyID, 0, len(identity.KeyIDs))
+		for _, kid := range identity.KeyIDs {
+			if kid != keyid {
+				updated.KeyIDs = append(updated.KeyIDs, kid)
+			}
+		}
+		u.identities = map[store.IdentityID]*store.Identity{updated.IdentityID: &updated}
+	}
+	return x.apply(u)
+}
+
+// update to the store, it is saved before it is applied so memory is
+// unchanged when the save fails
+type update struct {
+	// keys replaced, a nil record is deleted
+	keys       map[store.KeyID]*record
+	identities map[store.IdentityID]*store.Identity
+}
+
+func keyUpdate(keyid store.KeyID, res *record) update {
+	return update{keys: map[store.KeyID]*record{keyid: res}}
+}
+
+// apply requires the write lock
+func (x *MemoryStore) apply(u update) error {
+	err := x.save(u)
+	if err != nil {
+		return err
+	}
+
+	for kid, res := range u.keys {
+		if res == nil {
+			delete(x.db, kid)
+			continue
+		}
+		x.db[kid] = res
+	}
+	for id, identity := range u.identities {
+		x.identities[id] = identity
+	}
 	return nil
 }
@@ -1,15 +1,32 @@
 package memory
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"formation.engineering/oauth2-jwt/store"
 	x "formation.engineering/oauth2-jwt/store/testing"
+	jose "gopkg.in/square/go-jose.v2"
 )
 
+var priv, _ = rsa.GenerateKey(rand.Reader, 2048)
+
 func TestIdentity(t *testing.T) {
 	store := NewMemoryStore()
-	r0 := store.newIdentity()
-	r1 := store.newIdentity()
+	r0, err := store.newIdentity()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r1, err := store.newIdentity()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
 	if r0 == r1 {
 		t.Fatalf("Identities match [%s:%s]", r0, r1)
 	}
@@ -18,4 +35,171 @@ func TestIdentity(t *testing.T) {
 func TestMemoryStore(t *testing.T) {
 	store := NewMemoryStore()
 	x.TestStore(t, store)
+	x.TestListKeys(t, store)
+	x.TestKeyUsage(t, store)
+	x.TestIdentityKeys(t, store)
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	x.TestRevocationStore(t, NewRevocationStore())
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+	x.TestReplayCache(t, NewReplayCache())
+}
+
+type fixedIdentity string
+
+func (x fixedIdentity) NewIdentity() (string, error) {
+	return string(x), nil
+}
+
+func TestIdentityConflict(t *testing.T) {
+	s := NewMemoryStore()
+	s.Identities = fixedIdentity("1")
+
+	_, err := s.AddKey("a", store.AddKey{TenantID: "9999"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = s.AddKey("b", store.AddKey{TenantID: "9999"})
+	if !errors.Is(err, store.Conflict) {
+		t.Fatalf("expected identity conflict got [%v]", err)
+	}
+
+	// nothing is written on a conflict
+	if key, _ := s.GetKey("b"); key != nil {
+		t.Fatalf("expected key [b] to not exist got %+v", key)
+	}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	x.TestConcurrent(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store.json")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	x.TestStore(t, s)
+	x.TestIdentityKeys(t, s)
+
+	identityID, err := s.AddKey("persisted", store.AddKey{
+		PublicKey: jose.JSONWebKey{Key: &priv.PublicKey, KeyID: "persisted", Algorithm: "RS256"},
+		TenantID:  "9999",
+		Policy:    &store.KeyPolicy{MaxLifetime: time.Minute},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = s.SetKeyStatus("persisted", store.StatusChange{Status: store.KeyDisabled, ChangedBy: "gary"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// a restarted server reads back the same keys
+	loaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	key, err := loaded.GetKey("persisted")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if key == nil || key.IdentityID != *identityID || key.Status != store.KeyDisabled || key.Policy == nil || key.Policy.MaxLifetime != time.Minute {
+		t.Fatalf("expected persisted key got %+v", key)
+	}
+	if jwk, ok := key.PublicKey.(jose.JSONWebKey); !ok || !jwk.Valid() || jwk.KeyID != "persisted" {
+		t.Fatalf("expected persisted public key got %+v", key.PublicKey)
+	}
+
+	identity, err := loaded.GetIdentity(*identityID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if identity == nil || len(identity.KeyIDs) != 1 || identity.KeyIDs[0] != "persisted" {
+		t.Fatalf("expected persisted identity got %+v", identity)
+	}
+
+	x.TestConcurrent(t, loaded)
+}
+
+func TestFileStoreSaveFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store", "store.json")
+	if err := os.Mkdir(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	identityID, err := s.AddKey("kept", store.AddKey{
+		PublicKey: jose.JSONWebKey{Key: &priv.PublicKey, KeyID: "kept", Algorithm: "RS256"},
+		TenantID:  "9999",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// every save fails from here, memory must not run ahead of the file
+	if err := os.RemoveAll(filepath.Dir(path)); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = s.AddKey("lost", store.AddKey{PublicKey: &priv.PublicKey, TenantID: "9999"})
+	if err == nil {
+		t.Fatal("expected add to fail")
+	}
+	if key, _ := s.GetKey("lost"); key != nil {
+		t.Fatalf("expected no key got %+v", key)
+	}
+
+	err = s.AddIdentityKey(*identityID, "lost", store.AddKey{PublicKey: &priv.PublicKey, TenantID: "9999"})
+	if err == nil {
+		t.Fatal("expected add to fail")
+	}
+
+	err = s.SetKeyStatus("kept", store.StatusChange{Status: store.KeyDisabled, ChangedBy: "gary"})
+	if err == nil {
+		t.Fatal("expected status change to fail")
+	}
+	key, err := s.GetKey("kept")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if key == nil || key.Status != store.KeyActive {
+		t.Fatalf("expected active key got %+v", key)
+	}
+
+	err = s.DeleteKey("kept")
+	if err == nil {
+		t.Fatal("expected delete to fail")
+	}
+	if key, _ := s.GetKey("kept"); key == nil {
+		t.Fatal("expected key to be kept")
+	}
+
+	identity, err := s.GetIdentity(*identityID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if identity == nil || len(identity.KeyIDs) != 1 || identity.KeyIDs[0] != "kept" {
+		t.Fatalf("expected unchanged identity got %+v", identity)
+	}
 }
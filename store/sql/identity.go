@@ -0,0 +1,69 @@
+package sql
+
+import (
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+
+	"formation.engineering/oauth2-jwt/store"
+)
+
+func (x *SQLStore) GetIdentity(identityID store.IdentityID) (*store.Identity, error) {
+	identity, err := getIdentity(x.DB, identityID)
+	if err != nil || identity == nil {
+		return nil, err
+	}
+
+	rows, err := x.DB.Query(`SELECT key_id FROM api_keys WHERE identity_id = $1 ORDER BY key_id`, identityID)
+	if err != nil {
+		return nil, fmt.Errorf("identity keys: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kid string
+		err = rows.Scan(&kid)
+		if err != nil {
+			return nil, fmt.Errorf("identity keys: %w", err)
+		}
+		identity.KeyIDs = append(identity.KeyIDs, kid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("identity keys: %w", err)
+	}
+
+	return identity, nil
+}
+
+// getIdentity without its keys, nil if missing
+func getIdentity(q queryer, identityID store.IdentityID) (*store.Identity, error) {
+	var identity store.Identity
+	var created int64
+
+	err := q.QueryRow(`SELECT identity_id, tenant_id, tenant_name, application_name, created_by, created
+		FROM identities WHERE identity_id = $1`, identityID).
+		Scan(&identity.IdentityID, &identity.TenantID, &identity.TenantName, &identity.ApplicationName, &identity.CreatedBy, &created)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get identity: %w", err)
+	}
+
+	identity.Created = decodeTime(created)
+	return &identity, nil
+}
+
+func (x *SQLStore) AddIdentityKey(identityID store.IdentityID, kid store.KeyID, in store.AddKey) error {
+	return x.transact(func(tx *dbsql.Tx) error {
+		identity, err := getIdentity(tx, identityID)
+		if err != nil {
+			return err
+		}
+		if identity == nil {
+			return fmt.Errorf("identity [%s]: %w", identityID, store.NotFound)
+		}
+
+		return insertKey(tx, *identity, kid, in)
+	})
+}
@@ -0,0 +1,341 @@
+package sql
+
+import (
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+)
+
+// AddKey writes the key and its new identity in a single transaction,
+// neither is written on a conflict
+func (x *SQLStore) AddKey(kid store.KeyID, in store.AddKey) (*store.IdentityID, error) {
+	gen := x.Identities
+	if gen == nil {
+		gen = store.RandomIdentity{}
+	}
+	id, err := gen.NewIdentity()
+	if err != nil {
+		return nil, fmt.Errorf("new identity: %w", err)
+	}
+
+	identity := store.Identity{
+		IdentityID:      id,
+		TenantID:        in.TenantID,
+		TenantName:      in.TenantName,
+		ApplicationName: in.ApplicationName,
+		CreatedBy:       in.CreatedBy,
+		Created:         time.Now().UTC(),
+	}
+
+	err = x.transact(func(tx *dbsql.Tx) error {
+		res, err := tx.Exec(`INSERT INTO identities (identity_id, tenant_id, tenant_name, application_name, created_by, created)
+			VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (identity_id) DO NOTHING`,
+			identity.IdentityID, identity.TenantID, identity.TenantName, identity.ApplicationName, identity.CreatedBy, encodeTime(identity.Created))
+		err = inserted(res, err)
+		if errors.Is(err, store.Conflict) {
+			return fmt.Errorf("identity [%s]: %w", id, err)
+		}
+		if err != nil {
+			return fmt.Errorf("insert identity: %w", err)
+		}
+
+		return insertKey(tx, identity, kid, in)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
+
+// insertKey skips a conflicting insert rather than failing it, so the
+// conflict is read from the rows affected rather than a driver error
+func insertKey(tx *dbsql.Tx, identity store.Identity, kid store.KeyID, in store.AddKey) error {
+	pub, err := encodePublicKey(in.PublicKey)
+	if err != nil {
+		return err
+	}
+	scopes, err := encodeScopes(in.Scopes)
+	if err != nil {
+		return err
+	}
+	policy, err := encodePolicy(in.Policy)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`INSERT INTO api_keys (key_id, identity_id, tenant_id, tenant_name, application_name, created_by, created,
+			public_key, scopes, policy, status, expires_at, last_used, use_count, status_changed_at, status_changed_by, status_reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, 0, 0, 0, '', '') ON CONFLICT (key_id) DO NOTHING`,
+		kid, identity.IdentityID, identity.TenantID, identity.TenantName, identity.ApplicationName, in.CreatedBy,
+		encodeTime(time.Now().UTC()), pub, scopes, policy, string(store.KeyActive), encodeTime(in.ExpiresAt))
+	err = inserted(res, err)
+	if errors.Is(err, store.Conflict) {
+		return fmt.Errorf("key [%s]: %w", kid, err)
+	}
+	if err != nil {
+		return fmt.Errorf("insert key: %w", err)
+	}
+	return nil
+}
+
+// inserted is store.Conflict when an ON CONFLICT DO NOTHING insert skipped
+// the row, including one lost to a concurrent insert
+func inserted(res dbsql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.Conflict
+	}
+	return nil
+}
+
+func (x *SQLStore) GetKey(kid store.KeyID) (*store.KeyInfo, error) {
+	var pub, scopes, status string
+	var policy dbsql.NullString
+	var expiresAt int64
+	info := store.KeyInfo{}
+
+	err := x.DB.QueryRow(`SELECT public_key, identity_id, tenant_id, scopes, policy, status, expires_at
+		FROM api_keys WHERE key_id = $1`, kid).
+		Scan(&pub, &info.IdentityID, &info.TenantID, &scopes, &policy, &status, &expiresAt)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get key: %w", err)
+	}
+
+	info.PublicKey, err = decodePublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	info.Scopes, err = decodeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+	info.Policy, err = decodePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	info.Status = store.KeyStatus(status)
+	info.ExpiresAt = decodeTime(expiresAt)
+
+	return &info, nil
+}
+
+func (x *SQLStore) SetKeyStatus(kid store.KeyID, change store.StatusChange) error {
+	if !change.Status.Valid() {
+		return fmt.Errorf("invalid status [%s]", change.Status)
+	}
+
+	res, err := x.DB.Exec(`UPDATE api_keys SET status = $1, status_changed_at = $2, status_changed_by = $3, status_reason = $4
+		WHERE key_id = $5 AND status <> $6`,
+		string(change.Status), encodeTime(time.Now().UTC()), change.ChangedBy, change.Reason, kid, string(store.KeyRevoked))
+	if err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+	if updated > 0 {
+		return nil
+	}
+
+	// missing or revoked, the condition does not say which
+	exists, err := rowExists(x.DB, `SELECT 1 FROM api_keys WHERE key_id = $1`, kid)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("key [%s]: %w", kid, store.NotFound)
+	}
+	return fmt.Errorf("key [%s]: %w", kid, store.AlreadyRevoked)
+}
+
+const metadataColumns = `key_id, identity_id, tenant_id, application_name, created_by, created, status,
+	tenant_name, scopes, policy, expires_at, last_used, use_count, status_changed_at, status_changed_by, status_reason`
+
+func scanMetadata(row interface{ Scan(...interface{}) error }) (*store.KeyMetadata, error) {
+	var meta store.KeyMetadata
+	var created, expiresAt, lastUsed, statusChangedAt int64
+	var status, scopes string
+	var policy dbsql.NullString
+
+	err := row.Scan(&meta.KeyID, &meta.IdentityID, &meta.TenantID, &meta.ApplicationName, &meta.CreatedBy, &created, &status,
+		&meta.TenantName, &scopes, &policy, &expiresAt, &lastUsed, &meta.UseCount, &statusChangedAt, &meta.StatusChangedBy, &meta.StatusReason)
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Created = decodeTime(created)
+	meta.Status = store.KeyStatus(status)
+	meta.ExpiresAt = decodeTime(expiresAt)
+	meta.LastUsed = decodeTime(lastUsed)
+	meta.StatusChangedAt = decodeTime(statusChangedAt)
+
+	meta.Scopes, err = decodeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+	meta.Policy, err = decodePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (x *SQLStore) GetKeyMetadata(kid store.KeyID) (*store.KeyMetadata, error) {
+	meta, err := scanMetadata(x.DB.QueryRow(`SELECT `+metadataColumns+` FROM api_keys WHERE key_id = $1`, kid))
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get key metadata: %w", err)
+	}
+	return meta, nil
+}
+
+func (x *SQLStore) ListKeys(tenantID string, page store.Page) (*store.KeyPage, error) {
+	limit := page.PageLimit()
+
+	// one more than the page to tell whether there is a next
+	rows, err := x.DB.Query(`SELECT `+metadataColumns+` FROM api_keys
+		WHERE tenant_id = $1 AND key_id > $2 ORDER BY key_id LIMIT $3`, tenantID, page.Cursor, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("list keys: %w", err)
+	}
+	defer rows.Close()
+
+	out := store.KeyPage{Keys: []store.KeyMetadata{}}
+	for rows.Next() {
+		meta, err := scanMetadata(rows)
+		if err != nil {
+			return nil, fmt.Errorf("list keys: %w", err)
+		}
+		out.Keys = append(out.Keys, listed(*meta))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list keys: %w", err)
+	}
+
+	if len(out.Keys) > limit {
+		out.Keys = out.Keys[:limit]
+		out.Next = out.Keys[limit-1].KeyID
+	}
+	return &out, nil
+}
+
+// listed is the metadata returned by ListKeys
+func listed(meta store.KeyMetadata) store.KeyMetadata {
+	return store.KeyMetadata{
+		KeyID:           meta.KeyID,
+		IdentityID:      meta.IdentityID,
+		TenantID:        meta.TenantID,
+		ApplicationName: meta.ApplicationName,
+		CreatedBy:       meta.CreatedBy,
+		Created:         meta.Created,
+		Status:          meta.Status,
+	}
+}
+
+// KeyUsed writes at most once per key per Usage.Interval, uses in
+// between are counted and written with the next write
+func (x *SQLStore) KeyUsed(kid store.KeyID, at time.Time) error {
+	usage, due := x.Usage.Add(kid, at)
+	if !due {
+		return nil
+	}
+
+	err := x.writeUsage(kid, usage)
+	if err != nil {
+		x.Usage.Restore(kid, usage)
+		return err
+	}
+	return nil
+}
+
+// FlushUsage writes usage held back by the throttle, call on shutdown
+func (x *SQLStore) FlushUsage() error {
+	var failed error
+	for kid, usage := range x.Usage.Drain() {
+		err := x.writeUsage(kid, usage)
+		if err != nil {
+			x.Usage.Restore(kid, usage)
+			failed = err
+		}
+	}
+	return failed
+}
+
+func (x *SQLStore) writeUsage(kid store.KeyID, usage store.Usage) error {
+	res, err := x.DB.Exec(`UPDATE api_keys SET use_count = use_count + $1,
+		last_used = CASE WHEN last_used > $2 THEN last_used ELSE $2 END
+		WHERE key_id = $3`, usage.Count, encodeTime(usage.LastUsed), kid)
+	if err != nil {
+		return fmt.Errorf("update usage: %w", err)
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update usage: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("key [%s]: %w", kid, store.NotFound)
+	}
+	return nil
+}
+
+// DeleteKey keeps the identity, keys may be added to it again
+func (x *SQLStore) DeleteKey(kid store.KeyID) error {
+	_, err := x.DB.Exec(`DELETE FROM api_keys WHERE key_id = $1`, kid)
+	if err != nil {
+		return fmt.Errorf("delete key: %w", err)
+	}
+	return nil
+}
+
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *dbsql.Row
+}
+
+func rowExists(q queryer, query string, args ...interface{}) (bool, error) {
+	var one int
+	err := q.QueryRow(query, args...).Scan(&one)
+	if errors.Is(err, dbsql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("exists: %w", err)
+	}
+	return true, nil
+}
+
+func (x *SQLStore) transact(fn func(*dbsql.Tx) error) error {
+	tx, err := x.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
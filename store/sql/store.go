@@ -0,0 +1,198 @@
+// Package sql is a store.Store on database/sql. Only SQLite
+// (github.com/mattn/go-sqlite3) is supported, no other database is tested.
+// Parameters are numbered ($1) and first used in order.
+package sql
+
+import (
+	dbsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+type SQLStore struct {
+	DB *dbsql.DB
+	// Identities defaults to store.RandomIdentity
+	Identities store.IdentityGenerator
+	// Usage throttles KeyUsed writes
+	Usage store.UsageThrottle
+}
+
+// NewStore uses db as is, run Migrate before first use
+func NewStore(db *dbsql.DB) *SQLStore {
+	return &SQLStore{DB: db}
+}
+
+// migrations are applied in order, once each. Append only.
+var migrations = []string{
+	`CREATE TABLE identities (
+		identity_id      TEXT PRIMARY KEY,
+		tenant_id        TEXT NOT NULL,
+		tenant_name      TEXT NOT NULL,
+		application_name TEXT NOT NULL,
+		created_by       TEXT NOT NULL,
+		created          BIGINT NOT NULL
+	)`,
+	`CREATE TABLE api_keys (
+		key_id            TEXT PRIMARY KEY,
+		identity_id       TEXT NOT NULL REFERENCES identities (identity_id),
+		tenant_id         TEXT NOT NULL,
+		tenant_name       TEXT NOT NULL,
+		application_name  TEXT NOT NULL,
+		created_by        TEXT NOT NULL,
+		created           BIGINT NOT NULL,
+		public_key        TEXT NOT NULL,
+		scopes            TEXT NOT NULL,
+		policy            TEXT,
+		status            TEXT NOT NULL,
+		expires_at        BIGINT NOT NULL,
+		last_used         BIGINT NOT NULL,
+		use_count         BIGINT NOT NULL,
+		status_changed_at BIGINT NOT NULL,
+		status_changed_by TEXT NOT NULL,
+		status_reason     TEXT NOT NULL
+	)`,
+	`CREATE INDEX api_keys_tenant_id ON api_keys (tenant_id, key_id)`,
+	`CREATE INDEX api_keys_identity_id ON api_keys (identity_id)`,
+}
+
+// Migrate applies the migrations not yet recorded in schema_migrations,
+// each in its own transaction
+func (x *SQLStore) Migrate() error {
+	_, err := x.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var applied int
+	err = x.DB.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied)
+	if err != nil {
+		return fmt.Errorf("read schema_migrations: %w", err)
+	}
+
+	for version := applied; version < len(migrations); version++ {
+		err = x.migrate(version)
+		if err != nil {
+			return fmt.Errorf("migration [%d]: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (x *SQLStore) migrate(version int) error {
+	tx, err := x.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	_, err = tx.Exec(migrations[version])
+	if err != nil {
+		return err
+	}
+
+	// the primary key fails a concurrent migration of the same version
+	_, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// keyPolicy is the JSON of the policy column
+type keyPolicy struct {
+	MaxLifetime int64    `json:"max_lifetime,omitempty"` // seconds
+	Audiences   []string `json:"audiences,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+}
+
+func encodePolicy(p *store.KeyPolicy) (dbsql.NullString, error) {
+	if p == nil {
+		return dbsql.NullString{}, nil
+	}
+	raw, err := json.Marshal(keyPolicy{MaxLifetime: int64(p.MaxLifetime.Seconds()), Audiences: p.Audiences, Scopes: p.Scopes})
+	if err != nil {
+		return dbsql.NullString{}, fmt.Errorf("encode policy: %w", err)
+	}
+	return dbsql.NullString{String: string(raw), Valid: true}, nil
+}
+
+func decodePolicy(raw dbsql.NullString) (*store.KeyPolicy, error) {
+	if !raw.Valid {
+		return nil, nil
+	}
+	var p keyPolicy
+	err := json.Unmarshal([]byte(raw.String), &p)
+	if err != nil {
+		return nil, fmt.Errorf("decode policy: %w", err)
+	}
+	return &store.KeyPolicy{MaxLifetime: time.Duration(p.MaxLifetime) * time.Second, Audiences: p.Audiences, Scopes: p.Scopes}, nil
+}
+
+func encodeScopes(scopes []string) (string, error) {
+	if scopes == nil {
+		scopes = []string{}
+	}
+	raw, err := json.Marshal(scopes)
+	if err != nil {
+		return "", fmt.Errorf("encode scopes: %w", err)
+	}
+	return string(raw), nil
+}
+
+func decodeScopes(raw string) ([]string, error) {
+	var scopes []string
+	err := json.Unmarshal([]byte(raw), &scopes)
+	if err != nil {
+		return nil, fmt.Errorf("decode scopes: %w", err)
+	}
+	if len(scopes) == 0 {
+		return nil, nil
+	}
+	return scopes, nil
+}
+
+// encodePublicKey as a JWK, like dynamodb.PublicKeyDynamodb
+func encodePublicKey(key store.Key) (string, error) {
+	jwk, ok := key.(jose.JSONWebKey)
+	if !ok {
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+
+	raw, err := jwk.MarshalJSON()
+	if err != nil {
+		return "", fmt.Errorf("jose marshal: %w", err)
+	}
+	return string(raw), nil
+}
+
+func decodePublicKey(raw string) (store.Key, error) {
+	var jwk jose.JSONWebKey
+	err := jwk.UnmarshalJSON([]byte(raw))
+	if err != nil {
+		return nil, fmt.Errorf("decode jwk: %w", err)
+	}
+	if !jwk.Valid() {
+		return nil, fmt.Errorf("invalid jwk")
+	}
+	return jwk, nil
+}
+
+// times are unix nanoseconds, 0 for the zero time
+func encodeTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func decodeTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
@@ -0,0 +1,67 @@
+package sql
+
+import (
+	dbsql "database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	x "formation.engineering/oauth2-jwt/store/testing"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func sqlite(t *testing.T) *SQLStore {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	db, err := dbsql.Open("sqlite3", filepath.Join(dir, "store.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// sqlite allows a single writer
+	db.SetMaxOpenConns(1)
+
+	s := NewStore(db)
+	err = s.Migrate()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return s
+}
+
+func TestSQLStore(t *testing.T) {
+	store := sqlite(t)
+	x.TestStore(t, store)
+	x.TestListKeys(t, store)
+	x.TestKeyUsage(t, store)
+	x.TestIdentityKeys(t, store)
+}
+
+func TestSQLStoreConcurrent(t *testing.T) {
+	x.TestConcurrent(t, sqlite(t))
+}
+
+func TestMigrate(t *testing.T) {
+	s := sqlite(t)
+
+	// applied migrations are skipped
+	err := s.Migrate()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var applied int
+	err = s.DB.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if applied != len(migrations) {
+		t.Fatalf("expected [%d] migrations got [%d]", len(migrations), applied)
+	}
+}
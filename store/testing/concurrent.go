@@ -0,0 +1,115 @@
+package testing
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+)
+
+const (
+	concurrentWorkers    = 8
+	concurrentIterations = 25
+)
+
+// TestConcurrent exercises every operation from several goroutines, run it
+// with -race
+func TestConcurrent(t *testing.T, s store.Store) {
+	// unique per run, keys may outlive a failed test in a shared table
+	tenantID := fmt.Sprintf("ci-concurrent-%d", time.Now().UnixNano())
+	usage, _ := s.(store.UsageRecorder)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrentWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < concurrentIterations; i++ {
+				concurrentKey(t, s, usage, tenantID, fmt.Sprintf("%s-%d-%d", tenantID, w, i))
+			}
+		}(w)
+	}
+
+	// every worker races to add the same key, one wins
+	shared := tenantID + "-shared"
+	defer func() {
+		_ = s.DeleteKey(shared)
+	}()
+
+	var added, conflicts int
+	var mu sync.Mutex
+	for w := 0; w < concurrentWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.AddKey(shared, store.AddKey{PublicKey: priv1jwk.Public(), TenantID: tenantID})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				added++
+			case errors.Is(err, store.Conflict):
+				conflicts++
+			default:
+				t.Errorf("add key [%s] failure:\n%s", shared, err.Error())
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if added != 1 || conflicts != concurrentWorkers-1 {
+		t.Fatalf("add key [%s] failure: expected a single add got [%d] and [%d] conflicts", shared, added, conflicts)
+	}
+}
+
+func concurrentKey(t *testing.T, s store.Store, usage store.UsageRecorder, tenantID string, keyID store.KeyID) {
+	rotated := keyID + "-rotated"
+	defer func() {
+		_ = s.DeleteKey(keyID)
+		_ = s.DeleteKey(rotated)
+	}()
+
+	identityID, err := s.AddKey(keyID, store.AddKey{PublicKey: priv1jwk.Public(), TenantID: tenantID})
+	if err != nil {
+		t.Errorf("add key [%s] failure:\n%s", keyID, err.Error())
+		return
+	}
+
+	err = s.AddIdentityKey(*identityID, rotated, store.AddKey{PublicKey: priv2jwk.Public()})
+	if err != nil {
+		t.Errorf("add identity key [%s] failure:\n%s", rotated, err.Error())
+	}
+
+	if key, err := s.GetKey(keyID); err != nil || key == nil {
+		t.Errorf("get key [%s] failure: %+v [%v]", keyID, key, err)
+	}
+
+	err = s.SetKeyStatus(keyID, store.StatusChange{Status: store.KeyDisabled, ChangedBy: "gary"})
+	if err != nil {
+		t.Errorf("set key status [%s] failure:\n%s", keyID, err.Error())
+	}
+
+	if usage != nil {
+		err = usage.KeyUsed(rotated, time.Now())
+		if err != nil {
+			t.Errorf("key used [%s] failure:\n%s", rotated, err.Error())
+		}
+	}
+
+	if meta, err := s.GetKeyMetadata(keyID); err != nil || meta == nil || meta.Status != store.KeyDisabled {
+		t.Errorf("get key metadata [%s] failure: %+v [%v]", keyID, meta, err)
+	}
+
+	if identity, err := s.GetIdentity(*identityID); err != nil || identity == nil {
+		t.Errorf("get identity [%s] failure: %+v [%v]", *identityID, identity, err)
+	}
+
+	if _, err := s.ListKeys(tenantID, store.Page{}); err != nil {
+		t.Errorf("list keys [%s] failure:\n%s", tenantID, err.Error())
+	}
+}
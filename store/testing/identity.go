@@ -0,0 +1,93 @@
+package testing
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+)
+
+func TestIdentityKeys(t *testing.T, s store.Store) {
+	// unique per run, keys may outlive a failed test in a shared table
+	keyID1 := fmt.Sprintf("ci-identity-%d-1", time.Now().UnixNano())
+	keyID2 := keyID1[:len(keyID1)-1] + "2"
+	defer func() {
+		_ = s.DeleteKey(keyID1)
+		_ = s.DeleteKey(keyID2)
+	}()
+
+	identityID, err := s.AddKey(keyID1, store.AddKey{
+		PublicKey:       priv1jwk.Public(),
+		TenantID:        "9999",
+		TenantName:      "1",
+		ApplicationName: "foo",
+		CreatedBy:       "gary",
+	})
+	if err != nil {
+		t.Fatalf("add key [%s] failure:\n%s", keyID1, err.Error())
+	}
+
+	identity, err := s.GetIdentity(*identityID)
+	if err != nil {
+		t.Fatalf("get identity [%s] failure:\n%s", *identityID, err.Error())
+	}
+	if identity == nil || identity.TenantID != "9999" || identity.ApplicationName != "foo" || !sameSet(identity.KeyIDs, []string{keyID1}) {
+		t.Fatalf("get identity [%s] failure: mismatch %+v", *identityID, identity)
+	}
+
+	// the tenant is that of the identity
+	err = s.AddIdentityKey(*identityID, keyID2, store.AddKey{
+		PublicKey: priv2jwk.Public(),
+		TenantID:  "other",
+		CreatedBy: "darren",
+	})
+	if err != nil {
+		t.Fatalf("add identity key [%s] failure:\n%s", keyID2, err.Error())
+	}
+
+	key, err := s.GetKey(keyID2)
+	if err != nil {
+		t.Fatalf("get key [%s] failure:\n%s", keyID2, err.Error())
+	}
+	if key == nil || key.IdentityID != *identityID || key.TenantID != "9999" {
+		t.Fatalf("get key [%s] failure: expected identity [%s] got %+v", keyID2, *identityID, key)
+	}
+
+	identity, err = s.GetIdentity(*identityID)
+	if err != nil {
+		t.Fatalf("get identity [%s] failure:\n%s", *identityID, err.Error())
+	}
+	if identity == nil || !sameSet(identity.KeyIDs, []string{keyID1, keyID2}) {
+		t.Fatalf("get identity [%s] failure: expected both keys got %+v", *identityID, identity)
+	}
+
+	err = s.AddIdentityKey(*identityID, keyID1, store.AddKey{PublicKey: priv1jwk.Public()})
+	if !errors.Is(err, store.Conflict) {
+		t.Fatalf("expected add identity key conflict got [%v]", err)
+	}
+
+	err = s.AddIdentityKey("missing", keyID1+"-missing", store.AddKey{PublicKey: priv1jwk.Public()})
+	if !errors.Is(err, store.NotFound) {
+		t.Fatalf("add identity key failure: expected not found got [%v]", err)
+	}
+
+	missing, err := s.GetIdentity("missing")
+	if err != nil || missing != nil {
+		t.Fatalf("get identity [missing] failure: expected nil got %+v [%v]", missing, err)
+	}
+
+	// the identity outlives its keys
+	err = s.DeleteKey(keyID1)
+	if err != nil {
+		t.Fatalf("delete key [%s] failure:\n%s", keyID1, err.Error())
+	}
+	identity, err = s.GetIdentity(*identityID)
+	if err != nil {
+		t.Fatalf("get identity [%s] failure:\n%s", *identityID, err.Error())
+	}
+	if identity == nil || !sameSet(identity.KeyIDs, []string{keyID2}) {
+		t.Fatalf("get identity [%s] failure: expected remaining key got %+v", *identityID, identity)
+	}
+}
@@ -0,0 +1,77 @@
+package testing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+)
+
+func TestListKeys(t *testing.T, s store.Store) {
+	// unique per run, keys may outlive a failed test in a shared table
+	tenantID := fmt.Sprintf("ci-list-%d", time.Now().UnixNano())
+	keyIDs := []string{tenantID + "-a", tenantID + "-b", tenantID + "-c"}
+
+	defer func() {
+		for _, kid := range keyIDs {
+			_ = s.DeleteKey(kid)
+		}
+	}()
+
+	for _, kid := range keyIDs {
+		_, err := s.AddKey(kid, store.AddKey{
+			PublicKey:       priv1jwk.Public(),
+			TenantID:        tenantID,
+			TenantName:      "1",
+			ApplicationName: "app-" + kid,
+			CreatedBy:       "gary",
+		})
+		if err != nil {
+			t.Fatalf("add key [%s] failure:\n%s", kid, err.Error())
+		}
+	}
+
+	_, err := s.AddKey(tenantID+"-other", store.AddKey{
+		PublicKey: priv2jwk.Public(),
+		TenantID:  tenantID + "-other",
+	})
+	if err != nil {
+		t.Fatalf("add key failure:\n%s", err.Error())
+	}
+	defer func() { _ = s.DeleteKey(tenantID + "-other") }()
+
+	first, err := s.ListKeys(tenantID, store.Page{Limit: 2})
+	if err != nil {
+		t.Fatalf("list keys failure:\n%s", err.Error())
+	}
+	if len(first.Keys) != 2 || first.Next == "" {
+		t.Fatalf("list keys failure: expected a first page of 2 got %+v", first)
+	}
+
+	keys := first.Keys
+	for next := first.Next; next != ""; {
+		page, err := s.ListKeys(tenantID, store.Page{Limit: 2, Cursor: next})
+		if err != nil {
+			t.Fatalf("list keys failure:\n%s", err.Error())
+		}
+		keys = append(keys, page.Keys...)
+		next = page.Next
+	}
+
+	if len(keys) != len(keyIDs) {
+		t.Fatalf("list keys failure: expected %d keys got %+v", len(keyIDs), keys)
+	}
+
+	for i, k := range keys {
+		if k.KeyID != keyIDs[i] {
+			t.Fatalf("list keys failure: expected [%s] got [%s]", keyIDs[i], k.KeyID)
+		}
+		if k.TenantID != tenantID || k.IdentityID == "" || k.ApplicationName != "app-"+k.KeyID || k.CreatedBy != "gary" {
+			t.Fatalf("list keys failure: mismatch on metadata %+v", k)
+		}
+		if k.Status != store.KeyActive || k.Created.IsZero() {
+			t.Fatalf("list keys failure: mismatch on status or created %+v", k)
+		}
+	}
+}
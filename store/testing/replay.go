@@ -0,0 +1,54 @@
+package testing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+)
+
+func TestReplayCache(t *testing.T, c store.ReplayCache) {
+	// unique per run, ids outlive the test in a shared table
+	id := fmt.Sprintf("ci-%d", time.Now().UnixNano())
+	expiry := time.Now().Add(time.Minute)
+
+	seen, err := c.Seen("issuer", id, expiry)
+	if err != nil {
+		t.Fatalf("seen [%s] failure:\n%s", id, err.Error())
+	}
+	if seen {
+		t.Fatalf("seen [%s] failure: expected first use", id)
+	}
+
+	seen, err = c.Seen("issuer", id, expiry)
+	if err != nil {
+		t.Fatalf("seen [%s] failure:\n%s", id, err.Error())
+	}
+	if !seen {
+		t.Fatalf("seen [%s] failure: expected replay", id)
+	}
+
+	// ids are scoped by issuer
+	seen, err = c.Seen("other", id, expiry)
+	if err != nil {
+		t.Fatalf("seen [%s] failure:\n%s", id, err.Error())
+	}
+	if seen {
+		t.Fatalf("seen [%s] failure: expected first use by other issuer", id)
+	}
+
+	// expired ids may be reused
+	expired := id + "-expired"
+	_, err = c.Seen("issuer", expired, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("seen [%s] failure:\n%s", expired, err.Error())
+	}
+	seen, err = c.Seen("issuer", expired, expiry)
+	if err != nil {
+		t.Fatalf("seen [%s] failure:\n%s", expired, err.Error())
+	}
+	if seen {
+		t.Fatalf("seen [%s] failure: expected expired id to be reusable", expired)
+	}
+}
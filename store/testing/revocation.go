@@ -0,0 +1,72 @@
+package testing
+
+import (
+	"testing"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+)
+
+func TestRevocationStore(t *testing.T, s store.RevocationStore) {
+	now := time.Now().Truncate(time.Second)
+
+	live := store.Revocation{
+		TokenID:  "ci-revoked-live",
+		TenantID: "9999",
+		Expiry:   now.Add(time.Hour),
+	}
+	expired := store.Revocation{
+		TokenID:  "ci-revoked-expired",
+		TenantID: "9999",
+		Expiry:   now.Add(-time.Hour),
+	}
+
+	for _, r := range []store.Revocation{live, expired} {
+		err := s.Revoke(r)
+		if err != nil {
+			t.Fatalf("revoke [%s] failure:\n%s", r.TokenID, err.Error())
+		}
+	}
+
+	// Revoking twice is not an error
+	err := s.Revoke(live)
+	if err != nil {
+		t.Fatalf("revoke [%s] again failure:\n%s", live.TokenID, err.Error())
+	}
+
+	revoked, err := s.ListRevoked(now)
+	if err != nil {
+		t.Fatalf("list revoked failure:\n%s", err.Error())
+	}
+
+	found := map[string]store.Revocation{}
+	for _, r := range revoked {
+		found[r.TokenID] = r
+	}
+
+	r, ok := found[live.TokenID]
+	if !ok {
+		t.Fatalf("list revoked failure: missing [%s]", live.TokenID)
+	}
+	if r.TenantID != live.TenantID || !r.Expiry.Equal(live.Expiry) {
+		t.Fatalf("list revoked failure: mismatch %+v", r)
+	}
+
+	if _, ok := found[expired.TokenID]; ok {
+		t.Fatalf("list revoked failure: expired [%s] listed", expired.TokenID)
+	}
+
+	for id, expected := range map[string]bool{
+		live.TokenID:         true,
+		expired.TokenID:      false,
+		"ci-revoked-missing": false,
+	} {
+		ok, err := s.Revoked(id, now)
+		if err != nil {
+			t.Fatalf("revoked [%s] failure:\n%s", id, err.Error())
+		}
+		if ok != expected {
+			t.Fatalf("revoked [%s] failure: expected %t", id, expected)
+		}
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"formation.engineering/oauth2-jwt/store"
 	jose "gopkg.in/square/go-jose.v2"
@@ -30,6 +34,13 @@ func TestStore(t *testing.T, s store.Store) {
 		TenantName:      "1",
 		ApplicationName: "foo",
 		CreatedBy:       "gary",
+		Scopes:          []string{"read", "write"},
+		Policy: &store.KeyPolicy{
+			MaxLifetime: 5 * time.Minute,
+			Audiences:   []string{"formation"},
+			Scopes:      []string{"read"},
+		},
+		ExpiresAt: time.Now().Add(24 * time.Hour).Truncate(time.Second),
 	}
 	addKey2 := store.AddKey{
 		PublicKey:       pub2,
@@ -59,8 +70,8 @@ func TestStore(t *testing.T, s store.Store) {
 		t.Fatalf("add key failure:\n%s", err.Error())
 	}
 	_, err = s.AddKey(keyID1, addKey2)
-	if err == nil {
-		t.Fatal("expected add key failure, succeeded")
+	if !errors.Is(err, store.Conflict) {
+		t.Fatalf("expected add key conflict got [%v]", err)
 	}
 
 	var key *store.KeyInfo
@@ -82,6 +93,18 @@ func TestStore(t *testing.T, s store.Store) {
 		t.Fatal("get key [keyID1] failure: mismatch on IdentityID")
 	}
 
+	if !sameSet(k.Scopes, addKey1.Scopes) {
+		t.Fatalf("get key [keyID1] failure: mismatch on Scopes %v", k.Scopes)
+	}
+
+	if k.Policy == nil || k.Policy.MaxLifetime != addKey1.Policy.MaxLifetime || !sameSet(k.Policy.Audiences, addKey1.Policy.Audiences) || !sameSet(k.Policy.Scopes, addKey1.Policy.Scopes) {
+		t.Fatalf("get key [keyID1] failure: mismatch on Policy %+v", k.Policy)
+	}
+
+	if k.Status != store.KeyActive || !k.ExpiresAt.Equal(addKey1.ExpiresAt) {
+		t.Fatalf("get key [keyID1] failure: mismatch on Status [%s] or ExpiresAt [%s]", k.Status, k.ExpiresAt)
+	}
+
 	// Public key comparison
 	var j1 []byte
 	var j2 []byte
@@ -102,6 +125,94 @@ func TestStore(t *testing.T, s store.Store) {
 		t.Fatal("public key mismatch")
 	}
 
+	testKeyMetadata(t, s, keyID1, *id0, addKey1)
+	testKeyStatus(t, s, keyID1)
+}
+
+func testKeyMetadata(t *testing.T, s store.Store, keyID store.KeyID, identityID store.IdentityID, add store.AddKey) {
+	missing, err := s.GetKeyMetadata("missing")
+	if err != nil || missing != nil {
+		t.Fatalf("get key metadata [missing] failure: expected nil got %+v [%v]", missing, err)
+	}
+
+	meta, err := s.GetKeyMetadata(keyID)
+	if err != nil {
+		t.Fatalf("get key metadata [%s] failure:\n%s", keyID, err.Error())
+	}
+	if meta == nil {
+		t.Fatalf("get key metadata [%s] missing", keyID)
+	}
+
+	m := *meta
+	if m.KeyID != keyID || m.IdentityID != identityID || m.TenantID != add.TenantID || m.TenantName != add.TenantName {
+		t.Fatalf("get key metadata [%s] failure: mismatch on identity %+v", keyID, m)
+	}
+	if m.ApplicationName != add.ApplicationName || m.CreatedBy != add.CreatedBy || m.Created.IsZero() {
+		t.Fatalf("get key metadata [%s] failure: mismatch on creation %+v", keyID, m)
+	}
+	if !sameSet(m.Scopes, add.Scopes) {
+		t.Fatalf("get key metadata [%s] failure: mismatch on Scopes %v", keyID, m.Scopes)
+	}
+	if m.Policy == nil || m.Policy.MaxLifetime != add.Policy.MaxLifetime || !sameSet(m.Policy.Audiences, add.Policy.Audiences) || !sameSet(m.Policy.Scopes, add.Policy.Scopes) {
+		t.Fatalf("get key metadata [%s] failure: mismatch on Policy %+v", keyID, m.Policy)
+	}
+	if m.Status != store.KeyActive || !m.ExpiresAt.Equal(add.ExpiresAt) {
+		t.Fatalf("get key metadata [%s] failure: mismatch on Status [%s] or ExpiresAt [%s]", keyID, m.Status, m.ExpiresAt)
+	}
+	if !m.StatusChangedAt.IsZero() || m.StatusChangedBy != "" {
+		t.Fatalf("get key metadata [%s] failure: unexpected status change %+v", keyID, m)
+	}
+}
+
+func testKeyStatus(t *testing.T, s store.Store, keyID store.KeyID) {
+	status := func(expected store.KeyStatus) {
+		key, err := s.GetKey(keyID)
+		if err != nil {
+			t.Fatalf("get key [%s] failure:\n%s", keyID, err.Error())
+		}
+		if key == nil || key.Status != expected {
+			t.Fatalf("get key [%s] failure: expected status [%s] got %+v", keyID, expected, key)
+		}
+		if key.TenantID != "9999" {
+			t.Fatalf("get key [%s] failure: metadata lost %+v", keyID, key)
+		}
+	}
+
+	for _, next := range []store.KeyStatus{store.KeyDisabled, store.KeyActive, store.KeyRevoked} {
+		err := s.SetKeyStatus(keyID, store.StatusChange{Status: next, ChangedBy: "gary", Reason: "test"})
+		if err != nil {
+			t.Fatalf("set key status [%s] failure:\n%s", next, err.Error())
+		}
+		status(next)
+	}
+
+	err := s.SetKeyStatus(keyID, store.StatusChange{Status: store.KeyActive, ChangedBy: "gary"})
+	if !errors.Is(err, store.AlreadyRevoked) {
+		t.Fatalf("set key status failure: expected already revoked got [%v]", err)
+	}
+	status(store.KeyRevoked)
+
+	meta, err := s.GetKeyMetadata(keyID)
+	if err != nil {
+		t.Fatalf("get key metadata [%s] failure:\n%s", keyID, err.Error())
+	}
+	if meta == nil || meta.Status != store.KeyRevoked || meta.StatusChangedBy != "gary" || meta.StatusReason != "test" || meta.StatusChangedAt.IsZero() {
+		t.Fatalf("get key metadata [%s] failure: expected revoke audit got %+v", keyID, meta)
+	}
+
+	err = s.SetKeyStatus("missing", store.StatusChange{Status: store.KeyDisabled, ChangedBy: "gary"})
+	if !errors.Is(err, store.NotFound) {
+		t.Fatalf("set key status failure: expected not found got [%v]", err)
+	}
+}
+
+// sameSet ignores order, dynamodb string sets are unordered
+func sameSet(a, b []string) bool {
+	x := append([]string(nil), a...)
+	y := append([]string(nil), b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	return strings.Join(x, " ") == strings.Join(y, " ")
 }
 
 /*
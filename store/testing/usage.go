@@ -0,0 +1,64 @@
+package testing
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"formation.engineering/oauth2-jwt/store"
+)
+
+// TestKeyUsage expects the first use of a key to be written immediately,
+// later uses may be held back by a throttle
+func TestKeyUsage(t *testing.T, s store.Store) {
+	usage, ok := s.(store.UsageRecorder)
+	if !ok {
+		t.Fatal("store does not implement store.UsageRecorder")
+	}
+
+	// unique per run, keys may outlive a failed test in a shared table
+	keyID := fmt.Sprintf("ci-usage-%d", time.Now().UnixNano())
+	defer func() {
+		_ = s.DeleteKey(keyID)
+	}()
+
+	_, err := s.AddKey(keyID, store.AddKey{
+		PublicKey: priv1jwk.Public(),
+		TenantID:  "9999",
+	})
+	if err != nil {
+		t.Fatalf("add key [%s] failure:\n%s", keyID, err.Error())
+	}
+
+	meta, err := s.GetKeyMetadata(keyID)
+	if err != nil {
+		t.Fatalf("get key metadata [%s] failure:\n%s", keyID, err.Error())
+	}
+	if meta == nil || !meta.LastUsed.IsZero() || meta.UseCount != 0 {
+		t.Fatalf("get key metadata [%s] failure: expected unused got %+v", keyID, meta)
+	}
+
+	used := time.Now().Truncate(time.Second)
+	err = usage.KeyUsed(keyID, used)
+	if err != nil {
+		t.Fatalf("key used [%s] failure:\n%s", keyID, err.Error())
+	}
+	err = usage.KeyUsed(keyID, used.Add(time.Second))
+	if err != nil {
+		t.Fatalf("key used [%s] failure:\n%s", keyID, err.Error())
+	}
+
+	meta, err = s.GetKeyMetadata(keyID)
+	if err != nil {
+		t.Fatalf("get key metadata [%s] failure:\n%s", keyID, err.Error())
+	}
+	if meta == nil || meta.LastUsed.Before(used) || meta.UseCount < 1 {
+		t.Fatalf("get key metadata [%s] failure: expected used at [%s] got %+v", keyID, used, meta)
+	}
+
+	err = usage.KeyUsed("missing", used)
+	if err != nil && !errors.Is(err, store.NotFound) {
+		t.Fatalf("key used [missing] failure: expected not found got [%v]", err)
+	}
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultUsageInterval between writes of the usage of a single key
+const DefaultUsageInterval = 5 * time.Minute
+
+// UsageRecorder is optionally implemented by a ReadOnlyStore to track
+// when keys are used. Authorize calls KeyUsed after every successful
+// assertion, so implementations should throttle writes, see UsageThrottle.
+type UsageRecorder interface {
+	KeyUsed(keyid KeyID, at time.Time) error
+}
+
+// UsageFlusher is implemented by stores throttling KeyUsed. Uses held back
+// by the throttle are only written by FlushUsage or a later use of the
+// key, call it on shutdown or they are lost.
+type UsageFlusher interface {
+	FlushUsage() error
+}
+
+// Usage of a key accumulated since it was last written
+type Usage struct {
+	LastUsed time.Time
+	Count    int64
+}
+
+// UsageThrottle accumulates key usage so a store writes each key at most
+// once per Interval. The zero value is ready to use.
+type UsageThrottle struct {
+	// Interval defaults to DefaultUsageInterval
+	Interval time.Duration
+
+	mu      sync.Mutex
+	pending map[KeyID]*pendingUsage
+}
+
+type pendingUsage struct {
+	Usage
+	written time.Time
+}
+
+// Add records a use of keyid at. The accumulated usage is returned, and
+// reset, when it is due to be written.
+func (x *UsageThrottle) Add(keyid KeyID, at time.Time) (Usage, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.pending == nil {
+		x.pending = make(map[KeyID]*pendingUsage)
+	}
+
+	entry, ok := x.pending[keyid]
+	if !ok {
+		entry = &pendingUsage{}
+		x.pending[keyid] = entry
+	}
+
+	entry.Count++
+	if at.After(entry.LastUsed) {
+		entry.LastUsed = at
+	}
+
+	if !entry.written.IsZero() && at.Sub(entry.written) < x.interval() {
+		return Usage{}, false
+	}
+
+	usage := entry.Usage
+	entry.Usage = Usage{}
+	entry.written = at
+	return usage, true
+}
+
+// Restore returns usage that failed to be written, it is retried with
+// the next write of keyid
+func (x *UsageThrottle) Restore(keyid KeyID, usage Usage) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	entry, ok := x.pending[keyid]
+	if !ok {
+		return
+	}
+	entry.Count += usage.Count
+	if usage.LastUsed.After(entry.LastUsed) {
+		entry.LastUsed = usage.LastUsed
+	}
+	entry.written = time.Time{}
+}
+
+// Drain returns and resets the usage of every key not yet written, for a
+// final write on shutdown
+func (x *UsageThrottle) Drain() map[KeyID]Usage {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	out := make(map[KeyID]Usage)
+	for keyid, entry := range x.pending {
+		if entry.Count > 0 {
+			out[keyid] = entry.Usage
+		}
+		entry.Usage = Usage{}
+	}
+	return out
+}
+
+func (x *UsageThrottle) interval() time.Duration {
+	if x.Interval <= 0 {
+		return DefaultUsageInterval
+	}
+	return x.Interval
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUsageThrottle(t *testing.T) {
+	x := UsageThrottle{Interval: time.Minute}
+	now := time.Now()
+
+	usage, due := x.Add("1", now)
+	if !due || usage.Count != 1 || !usage.LastUsed.Equal(now) {
+		t.Fatalf("expected first use to be written, got %+v [%t]", usage, due)
+	}
+
+	for i := 1; i <= 3; i++ {
+		_, due = x.Add("1", now.Add(time.Duration(i)*time.Second))
+		if due {
+			t.Fatal("expected use within interval to be held back")
+		}
+	}
+
+	// failed writes are retried with the next
+	x.Restore("1", Usage{LastUsed: now, Count: 2})
+
+	usage, due = x.Add("1", now.Add(4*time.Second))
+	if !due || usage.Count != 6 || !usage.LastUsed.Equal(now.Add(4*time.Second)) {
+		t.Fatalf("expected accumulated usage to be written, got %+v [%t]", usage, due)
+	}
+
+	_, _ = x.Add("1", now.Add(5*time.Second))
+	drained := x.Drain()
+	if len(drained) != 1 || drained["1"].Count != 1 {
+		t.Fatalf("expected held back usage to be drained, got %+v", drained)
+	}
+	if len(x.Drain()) != 0 {
+		t.Fatal("expected drain to reset usage")
+	}
+}
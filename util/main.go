@@ -3,6 +3,7 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 
@@ -30,7 +31,12 @@ func main() {
 
 	switch os.Args[1] {
 	case "create":
-		req := client.Request{"tenant", "name", "application", "darren"}
+		req := client.Request{
+			TenantID:        "tenant",
+			TenantName:      "name",
+			ApplicationName: "application",
+			CreatedBy:       "darren",
+		}
 		creds, err := client.NewCredentials(b, memory.NewMemoryStore(), client.RSAGenerator{}, req)
 		if err != nil {
 			log.Fatal(err.Error())
@@ -46,6 +52,42 @@ func main() {
 		fmt.Printf("%s\n", creds.RenderPublicKey())
 		fmt.Printf("%s\n", creds.RenderPrivateKey())
 
+	case "server-rotate":
+		// key ring is read from stdin and the updated ring written to stdout
+		if len(os.Args) < 3 {
+			log.Fatal("expected one of 'publish', 'activate' or 'retire'")
+		}
+
+		raw, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		ring, err := admin.LoadKeyRing(raw)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		switch os.Args[2] {
+		case "publish":
+			err = ring.Publish()
+		case "activate":
+			err = ring.Activate()
+		case "retire":
+			err = ring.Retire()
+		default:
+			log.Fatalf("unexpected stage %s, expected one of 'publish', 'activate' or 'retire'", os.Args[2])
+		}
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		out, err := ring.Render()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		fmt.Printf("%s\n", out)
+
 	case "unsafe-grant":
 		if len(os.Args) < 3 {
 			log.Fatal("Not enough arguments to sign")
@@ -59,18 +101,23 @@ func main() {
 			log.Fatal(err.Error())
 		}
 
-		privateKey, err := admin.LoadPrivateKey([]byte(*rawPrivateKey))
+		ring, err := admin.LoadKeyRing([]byte(*rawPrivateKey))
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		config, err := server.ConfigFromKeyRing(*ring)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
 
-		res, err := server.Grant(b, server.Config{PrivateKey: privateKey}, tenant, nil)
+		res, err := server.Grant(b, *config, server.Authorized{TenantID: tenant})
 		if err != nil {
 			log.Fatal(err.Error())
 		}
 		fmt.Printf("curl -H 'Authorization: Bearer %s' -I https://api.helium.frmn-ops.com/v2/authenticate\n", res.Token)
 	default:
-		log.Fatalf("unexpected subcommand %s, expected one of 'create', 'server-bootstrap' or 'unsafe-grant'", os.Args[1])
+		log.Fatalf("unexpected subcommand %s, expected one of 'create', 'server-bootstrap', 'server-rotate' or 'unsafe-grant'", os.Args[1])
 	}
 
 	if loglevel.Level == loglevel.Debug {